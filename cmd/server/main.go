@@ -3,8 +3,9 @@ package main
 import (
 	"context"
 	"database/sql"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
@@ -13,34 +14,81 @@ import (
 
 	"github.com/Mavichy/AvitoNovember/internal/config"
 	"github.com/Mavichy/AvitoNovember/internal/httpapi"
+	"github.com/Mavichy/AvitoNovember/internal/logging"
+	"github.com/Mavichy/AvitoNovember/internal/metrics"
 	"github.com/Mavichy/AvitoNovember/internal/repository"
 	"github.com/Mavichy/AvitoNovember/internal/service"
 )
 
 func main() {
 	cfg := config.FromEnv()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.LogLevel})))
 
-	db, err := sql.Open("postgres", cfg.DBDSN)
-	if err != nil {
-		log.Fatalf("failed to open db: %v", err)
-	}
-	defer db.Close()
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
 
-	if err := db.Ping(); err != nil {
-		log.Fatalf("failed to ping db: %v", err)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" && cfg.Storage != config.StoragePostgres {
+		fatal("migrate requires STORAGE=postgres", nil)
 	}
 
-	repo := repository.NewRepository(db)
+	reg := metrics.NewRegistry()
 
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
+	var store service.Store
+	switch cfg.Storage {
+	case config.StorageMemory:
+		slog.Warn("using in-memory storage, data will be lost on restart")
+		store = repository.NewMemoryRepository()
+	default:
+		db, err := sql.Open("postgres", cfg.DBDSN)
+		if err != nil {
+			fatal("failed to open db", err)
+		}
+		defer db.Close()
+
+		if err := db.Ping(); err != nil {
+			fatal("failed to ping db", err)
+		}
+		reg.RegisterDBStats(db)
+
+		repo := repository.NewRepository(db)
+
+		if len(os.Args) > 1 && os.Args[1] == "migrate" {
+			if err := runMigrate(ctx, repo, os.Args[2:]); err != nil {
+				fatal("migrate", err)
+			}
+			return
+		}
+
+		if err := repo.Migrate(ctx); err != nil {
+			fatal("failed to run migrations", err)
+		}
+		store = repo
+	}
+
+	seed := time.Now().UnixNano()
+	if cfg.RandomSeed != nil {
+		seed = *cfg.RandomSeed
+		slog.Info("reviewer selection uses fixed random seed", "seed", seed)
+	}
 
-	if err := repo.Migrate(ctx); err != nil {
-		log.Fatalf("failed to run migrations: %v", err)
+	selectors, err := service.NewSelectors(
+		cfg.ReviewerStrategy,
+		cfg.TeamReviewerStrategies,
+		cfg.ReviewerWeights,
+		service.NewRand(seed),
+	)
+	if err != nil {
+		fatal("invalid reviewer strategy config", err)
 	}
 
-	svc := service.NewService(repo)
-	handler := httpapi.NewHandler(svc)
+	svc := service.NewService(store,
+		service.WithSelectors(selectors),
+		service.WithPairAvoidance(cfg.PairWindow),
+		service.WithMetrics(reg),
+	)
+	handler := httpapi.NewHandler(svc, reg)
+
+	go runAbsenceWatcher(ctx, svc, cfg.AbsenceCheckInterval)
 
 	srv := &http.Server{
 		Addr:    ":" + cfg.HTTPPort,
@@ -48,19 +96,54 @@ func main() {
 	}
 
 	go func() {
-		log.Printf("server listening on :%s", cfg.HTTPPort)
+		slog.Info("server listening", "addr", srv.Addr)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("server error: %v", err)
+			fatal("server error", err)
 		}
 	}()
 
 	<-ctx.Done()
-	log.Println("shutting down server...")
+	slog.Info("shutting down server")
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer shutdownCancel()
 
 	if err := srv.Shutdown(shutdownCtx); err != nil {
-		log.Printf("graceful shutdown failed: %v", err)
+		slog.Error("graceful shutdown failed", "error", err)
+	}
+}
+
+// fatal logs msg with err, if any, and exits.
+func fatal(msg string, err error) {
+	if err != nil {
+		slog.Error(msg, "error", err)
+	} else {
+		slog.Error(msg)
+	}
+	os.Exit(1)
+}
+
+// runAbsenceWatcher periodically hands over the reviews of users whose
+// absence has started, until ctx is cancelled.
+func runAbsenceWatcher(ctx context.Context, svc *service.Service, interval time.Duration) {
+	logger := slog.Default().With("component", "absence_watcher")
+	ctx = logging.WithLogger(ctx, logger)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changes, err := svc.ProcessStartedAbsences(ctx)
+			if err != nil {
+				logger.ErrorContext(ctx, "process started absences", "error", err)
+				continue
+			}
+			if len(changes) > 0 {
+				logger.InfoContext(ctx, "released reviewer assignments of absent users", "count", len(changes))
+			}
+		}
 	}
 }
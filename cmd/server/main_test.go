@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+	"github.com/Mavichy/AvitoNovember/internal/repository"
+	"github.com/Mavichy/AvitoNovember/internal/service"
+)
+
+func TestAbsenceWatcher(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	svc := service.NewService(repo)
+	team := model.Team{TeamName: "backend"}
+	for _, id := range []string{"a", "b", "c"} {
+		team.Members = append(team.Members, model.TeamMember{UserID: id, Username: id, IsActive: true})
+	}
+	if _, err := svc.AddTeam(ctx, team); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.CreatePR(ctx, service.CreatePRInput{ID: "p", Name: "p", AuthorID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	// Set in the store directly, as if the absence had been scheduled
+	// earlier and has just started.
+	now := time.Now()
+	if err := repo.SetAbsences(ctx, "b", []model.Absence{{StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		runAbsenceWatcher(watchCtx, svc, 10*time.Millisecond)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		pr, err := repo.GetPR(ctx, "p")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pr.AssignedReviewers) == 1 && pr.AssignedReviewers[0] == "c" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("reviewers = %v, want b released", pr.AssignedReviewers)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
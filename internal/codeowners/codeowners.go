@@ -0,0 +1,128 @@
+// Package codeowners parses ownership rules in CODEOWNERS syntax and matches
+// file paths against them.
+//
+// Each non-empty line that is not a comment is a pattern followed by owners:
+//
+//	# payments owners review everything under /payments
+//	/payments/          @team/payments
+//	*.sql               @u1 @u7
+//	docs/*              @u3
+//
+// Patterns follow the CODEOWNERS (gitignore) rules: a leading "/" or a "/" in
+// the middle anchors the pattern to the repository root, otherwise it matches
+// at any depth; "*" and "?" do not cross "/", "**" does; a pattern naming a
+// directory also matches everything below it. The last matching line wins.
+//
+// Owners are "@<user_id>" or "@team/<team_name>".
+package codeowners
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TeamOwnerPrefix marks an owner that is a whole team.
+const TeamOwnerPrefix = "@team/"
+
+type Rule struct {
+	Pattern string
+	// Owners are the raw owner tokens; empty means the paths have no owner.
+	Owners []string
+	re     *regexp.Regexp
+}
+
+type Ruleset []Rule
+
+// Parse reads rules from text. Errors mention the line number.
+func Parse(text string) (Ruleset, error) {
+	var rs Ruleset
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if idx := strings.Index(line, " #"); idx >= 0 {
+			line = strings.TrimSpace(line[:idx])
+		}
+
+		fields := strings.Fields(line)
+		re, err := compile(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		for _, owner := range fields[1:] {
+			if !strings.HasPrefix(owner, "@") || len(owner) == 1 || owner == TeamOwnerPrefix {
+				return nil, fmt.Errorf("line %d: invalid owner %q, expected @user_id or @team/name", i+1, owner)
+			}
+		}
+
+		rs = append(rs, Rule{Pattern: fields[0], Owners: fields[1:], re: re})
+	}
+	return rs, nil
+}
+
+// Match returns the last rule matching path.
+func (rs Ruleset) Match(path string) (Rule, bool) {
+	path = strings.TrimPrefix(path, "/")
+	for i := len(rs) - 1; i >= 0; i-- {
+		if rs[i].re.MatchString(path) {
+			return rs[i], true
+		}
+	}
+	return Rule{}, false
+}
+
+// ParseOwner splits an owner token into a user id or a team name.
+func ParseOwner(owner string) (userID, teamName string) {
+	if name, ok := strings.CutPrefix(owner, TeamOwnerPrefix); ok {
+		return "", name
+	}
+	return strings.TrimPrefix(owner, "@"), ""
+}
+
+func compile(pattern string) (*regexp.Regexp, error) {
+	p := pattern
+	dirOnly := strings.HasSuffix(p, "/")
+	p = strings.TrimSuffix(p, "/")
+	anchored := strings.HasPrefix(p, "/") || strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return nil, fmt.Errorf("invalid pattern %q", pattern)
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; {
+		case strings.HasPrefix(p[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	// A pattern whose last segment has no wildcard may name a directory and
+	// then owns its contents too; "docs/*" owns only direct children.
+	last := p[strings.LastIndex(p, "/")+1:]
+	switch {
+	case dirOnly:
+		b.WriteString("/.*")
+	case !strings.ContainsAny(last, "*?"):
+		b.WriteString("(?:/.*)?")
+	}
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
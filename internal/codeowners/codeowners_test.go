@@ -0,0 +1,131 @@
+package codeowners
+
+import "testing"
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		// Unanchored patterns match at any depth.
+		{"*.sql", "schema.sql", true},
+		{"*.sql", "db/migrations/001.sql", true},
+		{"*.sql", "schema.sql.bak", false},
+		{"Makefile", "Makefile", true},
+		{"Makefile", "tools/Makefile", true},
+
+		// A leading or inner "/" anchors the pattern to the root.
+		{"/Makefile", "Makefile", true},
+		{"/Makefile", "tools/Makefile", false},
+		{"docs/api.md", "docs/api.md", true},
+		{"docs/api.md", "web/docs/api.md", false},
+		{"/build.go", "/build.go", true},
+
+		// A directory owns everything below it.
+		{"/payments/", "payments/api/handler.go", true},
+		{"/payments/", "payments", false},
+		{"/payments/", "billing/payments/x.go", false},
+		{"payments/", "billing/payments/x.go", true},
+		{"/payments", "payments/api/handler.go", true},
+		{"/payments", "payments", true},
+		{"/payments", "paymentsv2/x.go", false},
+
+		// "*" and "?" stay within a segment.
+		{"docs/*", "docs/intro.md", true},
+		{"docs/*", "docs/guides/intro.md", false},
+		{"/cmd/?.go", "cmd/a.go", true},
+		{"/cmd/?.go", "cmd/ab.go", false},
+
+		// "**" crosses directories.
+		{"**/testdata/", "testdata/x.json", true},
+		{"**/testdata/", "internal/service/testdata/x.json", true},
+		{"/internal/**/store.go", "internal/store.go", true},
+		{"/internal/**/store.go", "internal/service/store.go", true},
+		{"/internal/**/store.go", "internal/a/b/store.go", true},
+		{"/internal/**/store.go", "cmd/store.go", false},
+		{"/docs/**", "docs/a/b/c.md", true},
+		{"/docs/**", "web/docs/a.md", false},
+
+		// Regexp metacharacters are literal.
+		{"/a+b.txt", "a+b.txt", true},
+		{"/a+b.txt", "aab.txt", false},
+	}
+	for _, tt := range tests {
+		rs, err := Parse(tt.pattern + " @u1")
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.pattern, err)
+		}
+		if _, got := rs.Match(tt.path); got != tt.want {
+			t.Errorf("%q matches %q = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMatchLastRuleWins(t *testing.T) {
+	rs, err := Parse(`
+# everything else
+*                  @u1
+/payments/         @team/payments @u2
+/payments/docs/    # no owner
+*.sql              @u3 # inline comment
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		pattern string
+		owners  int
+	}{
+		{"README.md", "*", 1},
+		{"payments/api.go", "/payments/", 2},
+		{"payments/docs/index.md", "/payments/docs/", 0},
+		{"payments/schema.sql", "*.sql", 1},
+		{"payments/docs/schema.sql", "*.sql", 1},
+	}
+	for _, tt := range tests {
+		rule, ok := rs.Match(tt.path)
+		if !ok {
+			t.Errorf("%q: no rule matched", tt.path)
+			continue
+		}
+		if rule.Pattern != tt.pattern || len(rule.Owners) != tt.owners {
+			t.Errorf("%q: matched %q with %d owners, want %q with %d",
+				tt.path, rule.Pattern, len(rule.Owners), tt.pattern, tt.owners)
+		}
+	}
+
+	if _, ok := Ruleset(nil).Match("a.go"); ok {
+		t.Errorf("empty ruleset matched")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, text := range []string{
+		"/ @u1",
+		"*.go u1",
+		"*.go @",
+		"*.go @team/",
+	} {
+		if _, err := Parse(text); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", text)
+		}
+	}
+}
+
+func TestParseOwner(t *testing.T) {
+	tests := []struct {
+		owner, userID, teamName string
+	}{
+		{"@u1", "u1", ""},
+		{"@team/payments", "", "payments"},
+	}
+	for _, tt := range tests {
+		userID, teamName := ParseOwner(tt.owner)
+		if userID != tt.userID || teamName != tt.teamName {
+			t.Errorf("ParseOwner(%q) = %q, %q; want %q, %q", tt.owner, userID, teamName, tt.userID, tt.teamName)
+		}
+	}
+}
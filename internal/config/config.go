@@ -2,12 +2,43 @@ package config
 
 import (
 	"log"
+	"log/slog"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory"
 )
 
 type Config struct {
 	HTTPPort string
-	DBDSN    string
+	// Storage selects the store backend: "postgres" (default) or "memory".
+	Storage string
+	DBDSN   string
+
+	// ReviewerStrategy is the default reviewer selection strategy.
+	ReviewerStrategy string
+	// TeamReviewerStrategies overrides the strategy per team.
+	TeamReviewerStrategies map[string]string
+	// ReviewerWeights are per-user weights for the weighted strategy.
+	ReviewerWeights map[string]int
+	// RandomSeed makes reviewer selection deterministic when set.
+	RandomSeed *int64
+
+	// AbsenceCheckInterval is how often started absences are looked up to
+	// reassign the reviews of absent users.
+	AbsenceCheckInterval time.Duration
+
+	// PairWindow is how far back author→reviewer pairings are taken into
+	// account to spread reviews; 0 (the default) disables pair avoidance.
+	PairWindow time.Duration
+
+	// LogLevel is the minimum level of the JSON logs.
+	LogLevel slog.Level
 }
 
 func FromEnv() Config {
@@ -16,13 +47,99 @@ func FromEnv() Config {
 		port = "8080"
 	}
 
+	storage := os.Getenv("STORAGE")
+	if storage == "" {
+		storage = StoragePostgres
+	}
+	if storage != StoragePostgres && storage != StorageMemory {
+		log.Fatalf("env STORAGE: unknown storage %q", storage)
+	}
+
 	dsn := os.Getenv("DB_DSN")
-	if dsn == "" {
+	if dsn == "" && storage == StoragePostgres {
 		log.Fatal("env DB_DSN is required")
 	}
 
+	strategy := os.Getenv("REVIEWER_STRATEGY")
+	if strategy == "" {
+		strategy = "random"
+	}
+
+	weights := make(map[string]int)
+	for user, raw := range parsePairs("REVIEWER_WEIGHTS") {
+		w, err := strconv.Atoi(raw)
+		if err != nil {
+			log.Fatalf("env REVIEWER_WEIGHTS: invalid weight %q for %s", raw, user)
+		}
+		weights[user] = w
+	}
+
+	var seed *int64
+	if raw := os.Getenv("REVIEWER_RANDOM_SEED"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			log.Fatalf("env REVIEWER_RANDOM_SEED: invalid seed %q", raw)
+		}
+		seed = &v
+	}
+
+	absenceInterval := time.Minute
+	if raw := os.Getenv("ABSENCE_CHECK_INTERVAL"); raw != "" {
+		v, err := time.ParseDuration(raw)
+		if err != nil || v <= 0 {
+			log.Fatalf("env ABSENCE_CHECK_INTERVAL: invalid duration %q", raw)
+		}
+		absenceInterval = v
+	}
+
+	var pairWindow time.Duration
+	if raw := os.Getenv("PAIR_AVOIDANCE_WINDOW"); raw != "" {
+		v, err := time.ParseDuration(raw)
+		if err != nil || v < 0 {
+			log.Fatalf("env PAIR_AVOIDANCE_WINDOW: invalid duration %q", raw)
+		}
+		pairWindow = v
+	}
+
+	var logLevel slog.Level
+	if raw := os.Getenv("LOG_LEVEL"); raw != "" {
+		if err := logLevel.UnmarshalText([]byte(raw)); err != nil {
+			log.Fatalf("env LOG_LEVEL: invalid level %q", raw)
+		}
+	}
+
 	return Config{
-		HTTPPort: port,
-		DBDSN:    dsn,
+		HTTPPort:               port,
+		Storage:                storage,
+		DBDSN:                  dsn,
+		ReviewerStrategy:       strategy,
+		TeamReviewerStrategies: parsePairs("TEAM_REVIEWER_STRATEGIES"),
+		ReviewerWeights:        weights,
+		RandomSeed:             seed,
+		AbsenceCheckInterval:   absenceInterval,
+		PairWindow:             pairWindow,
+		LogLevel:               logLevel,
+	}
+}
+
+// parsePairs reads an env variable of the form "key1:value1,key2:value2".
+func parsePairs(env string) map[string]string {
+	res := make(map[string]string)
+	raw := os.Getenv(env)
+	if raw == "" {
+		return res
+	}
+
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, ":")
+		if !ok || key == "" {
+			log.Fatalf("env %s: invalid entry %q, expected key:value", env, pair)
+		}
+		res[strings.TrimSpace(key)] = strings.TrimSpace(value)
 	}
+	return res
 }
@@ -1,9 +1,16 @@
 package httpapi
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/Mavichy/AvitoNovember/internal/codeowners"
+	"github.com/Mavichy/AvitoNovember/internal/logging"
+	"github.com/Mavichy/AvitoNovember/internal/metrics"
 	"github.com/Mavichy/AvitoNovember/internal/model"
 	"github.com/Mavichy/AvitoNovember/internal/service"
 )
@@ -12,29 +19,58 @@ type Handler struct {
 	svc *service.Service
 }
 
-func NewHandler(svc *service.Service) http.Handler {
+// NewHandler builds the API routes. Every request gets a request ID and an
+// access log line; with a non-nil registry the requests are also
+// instrumented and the metrics are served on /metrics.
+func NewHandler(svc *service.Service, reg *metrics.Registry) http.Handler {
 	h := &Handler{svc: svc}
 
 	mux := http.NewServeMux()
 
 	mux.Handle("/team/add", method("POST", h.handleTeamAdd))
 	mux.Handle("/team/get", method("GET", h.handleTeamGet))
+	mux.Handle("/team/update", method("POST", h.handleTeamUpdate))
+	mux.Handle("/team/addMembers", method("POST", h.handleTeamAddMembers))
+	mux.Handle("/team/removeMember", method("POST", h.handleTeamRemoveMember))
+	mux.Handle("/team/moveMember", method("POST", h.handleTeamMoveMember))
+	mux.Handle("/team/archive", method("POST", h.handleTeamArchive))
+	mux.Handle("/team/unarchive", method("POST", h.handleTeamUnarchive))
+	mux.Handle("/team/delete", method("POST", h.handleTeamDelete))
+	mux.Handle("/team/setCodeOwners", method("POST", h.handleTeamSetCodeOwners))
+	mux.Handle("/team/getCodeOwners", method("GET", h.handleTeamGetCodeOwners))
 	mux.Handle("/team/deactivateAndReassign", method("POST", h.handleTeamDeactivateAndReassign))
 
 	mux.Handle("/users/setIsActive", method("POST", h.handleUsersSetIsActive))
+	mux.Handle("/users/rename", method("POST", h.handleUsersRename))
+	mux.Handle("/users/setCapacity", method("POST", h.handleUsersSetCapacity))
+	mux.Handle("/users/setTags", method("POST", h.handleUsersSetTags))
 	mux.Handle("/users/getReview", method("GET", h.handleUsersGetReview))
+	mux.Handle("/users/setAbsence", method("POST", h.handleUsersSetAbsence))
+	mux.Handle("/users/getAbsence", method("GET", h.handleUsersGetAbsence))
 
 	mux.Handle("/pullRequest/create", method("POST", h.handlePRCreate))
 	mux.Handle("/pullRequest/merge", method("POST", h.handlePRMerge))
 	mux.Handle("/pullRequest/reassign", method("POST", h.handlePRReassign))
+	mux.Handle("/pullRequest/review", method("POST", h.handlePRReview))
+	mux.Handle("/pullRequest/close", method("POST", h.handlePRClose))
+	mux.Handle("/pullRequest/reopen", method("POST", h.handlePRReopen))
+	mux.Handle("/pullRequest/markReady", method("POST", h.handlePRMarkReady))
 
 	mux.Handle("/stats/reviewers", method("GET", h.handleStatsReviewers))
+	mux.Handle("/stats/teams", method("GET", h.handleStatsTeams))
+	mux.Handle("/stats/pairings", method("GET", h.handleStatsPairings))
+	mux.Handle("/stats/pullRequests", method("GET", h.handleStatsPullRequests))
+	mux.Handle("/stats/fairness", method("GET", h.handleStatsFairness))
 
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 	})
 
-	return mux
+	if reg == nil {
+		return serve(mux, nil)
+	}
+	mux.Handle("/metrics", method("GET", reg.Handler().ServeHTTP))
+	return serve(mux, newHTTPMetrics(reg))
 }
 
 func method(method string, h func(http.ResponseWriter, *http.Request)) http.Handler {
@@ -61,7 +97,15 @@ func writeDomainError(w http.ResponseWriter, err *service.DomainError, defaultSt
 	case model.ErrorCodePRExists,
 		model.ErrorCodePRMerged,
 		model.ErrorCodeNotAssigned,
-		model.ErrorCodeNoCandidate:
+		model.ErrorCodeNoCandidate,
+		model.ErrorCodeMergeBlocked,
+		model.ErrorCodeInvalidTransition,
+		model.ErrorCodePRNotOpen,
+		model.ErrorCodeUserInOtherTeam,
+		model.ErrorCodeTeamArchived,
+		model.ErrorCodeTeamNotArchived,
+		model.ErrorCodeInvalidHierarchy,
+		model.ErrorCodeNoCodeOwner:
 		status = http.StatusConflict
 	case model.ErrorCodeNotFound:
 		status = http.StatusNotFound
@@ -69,6 +113,7 @@ func writeDomainError(w http.ResponseWriter, err *service.DomainError, defaultSt
 		status = defaultStatus
 	}
 
+	recordErrorCode(w, err.Code)
 	writeJSON(w, status, model.ErrorResponse{
 		Error: model.ErrorDetail{
 			Code:    err.Code,
@@ -77,12 +122,25 @@ func writeDomainError(w http.ResponseWriter, err *service.DomainError, defaultSt
 	})
 }
 
-func writeError(w http.ResponseWriter, err error) {
+// writeError writes err as a domain error, or hides it behind a 500 and logs
+// it with the request ID.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
 	if de, ok := service.AsDomainError(err); ok {
 		writeDomainError(w, de, http.StatusInternalServerError)
 		return
 	}
+	var ve *service.ValidationError
+	if errors.As(err, &ve) {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: ve.Message,
+			},
+		})
+		return
+	}
 
+	logging.FromContext(r.Context()).ErrorContext(r.Context(), "internal server error", "error", err)
 	writeJSON(w, http.StatusInternalServerError, model.ErrorResponse{
 		Error: model.ErrorDetail{
 			Code:    model.ErrorCodeNotFound,
@@ -104,9 +162,29 @@ func (h *Handler) handleTeamAdd(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.ReviewerCount < 0 || req.RequiredApprovals < 0 {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "reviewer_count and required_approvals must not be negative",
+			},
+		})
+		return
+	}
+
+	if req.ParentTeam != "" && req.ParentTeam == req.TeamName {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "a team cannot be its own parent",
+			},
+		})
+		return
+	}
+
 	team, err := h.svc.AddTeam(r.Context(), req)
 	if err != nil {
-		writeError(w, err)
+		writeError(w, r, err)
 		return
 	}
 
@@ -115,7 +193,7 @@ func (h *Handler) handleTeamAdd(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// GET /team/get?team_name=...
+// GET /team/get?team_name=...&include_subteams=true
 func (h *Handler) handleTeamGet(w http.ResponseWriter, r *http.Request) {
 	teamName := r.URL.Query().Get("team_name")
 	if teamName == "" {
@@ -128,36 +206,108 @@ func (h *Handler) handleTeamGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	team, err := h.svc.GetTeam(r.Context(), teamName)
+	getTeam := h.svc.GetTeam
+	if r.URL.Query().Get("include_subteams") == "true" {
+		getTeam = h.svc.GetTeamTree
+	}
+
+	team, err := getTeam(r.Context(), teamName)
 	if err != nil {
-		writeError(w, err)
+		writeError(w, r, err)
 		return
 	}
 
 	writeJSON(w, http.StatusOK, team)
 }
 
-// POST /users/setIsActive
-type setIsActiveRequest struct {
-	UserID   string `json:"user_id"`
-	IsActive bool   `json:"is_active"`
+// POST /team/update
+type teamUpdateRequest struct {
+	TeamName          string    `json:"team_name"`
+	ReviewerCount     *int      `json:"reviewer_count"`
+	RequiredApprovals *int      `json:"required_approvals"`
+	ClimbHierarchy    *bool     `json:"climb_hierarchy"`
+	FallbackTeams     *[]string `json:"fallback_teams"`
+	ParentTeam        *string   `json:"parent_team"`
 }
 
-type teamDeactivateRequest struct {
-	TeamName string   `json:"team_name"`
-	UserIDs  []string `json:"user_ids"`
+func (h *Handler) handleTeamUpdate(w http.ResponseWriter, r *http.Request) {
+	var req teamUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "invalid json",
+			},
+		})
+		return
+	}
+
+	if req.TeamName == "" {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "team_name is required",
+			},
+		})
+		return
+	}
+
+	if req.ReviewerCount != nil && *req.ReviewerCount < 1 {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "reviewer_count must be positive",
+			},
+		})
+		return
+	}
+
+	if req.RequiredApprovals != nil && *req.RequiredApprovals < 0 {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "required_approvals must not be negative",
+			},
+		})
+		return
+	}
+
+	if req.ParentTeam != nil && *req.ParentTeam == req.TeamName {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "a team cannot be its own parent",
+			},
+		})
+		return
+	}
+
+	team, err := h.svc.UpdateTeam(r.Context(), service.UpdateTeamInput{
+		TeamName:          req.TeamName,
+		ReviewerCount:     req.ReviewerCount,
+		RequiredApprovals: req.RequiredApprovals,
+		ClimbHierarchy:    req.ClimbHierarchy,
+		FallbackTeams:     req.FallbackTeams,
+		ParentTeam:        req.ParentTeam,
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"team": team,
+	})
 }
 
-type teamDeactivateResponse struct {
-	TeamName             string   `json:"team_name"`
-	Deactivated          []string `json:"deactivated"`
-	ReassignedReviewers  int      `json:"reassigned_reviewers"`
-	RemovedReviewers     int      `json:"removed_reviewers"`
-	AffectedPullRequests int      `json:"affected_pull_requests"`
+// POST /team/addMembers
+type teamAddMembersRequest struct {
+	TeamName string             `json:"team_name"`
+	Members  []model.TeamMember `json:"members"`
 }
 
-func (h *Handler) handleUsersSetIsActive(w http.ResponseWriter, r *http.Request) {
-	var req setIsActiveRequest
+func (h *Handler) handleTeamAddMembers(w http.ResponseWriter, r *http.Request) {
+	var req teamAddMembersRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
 			Error: model.ErrorDetail{
@@ -168,51 +318,52 @@ func (h *Handler) handleUsersSetIsActive(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	user, err := h.svc.SetUserIsActive(r.Context(), req.UserID, req.IsActive)
+	team, err := h.svc.AddTeamMembers(r.Context(), req.TeamName, req.Members)
 	if err != nil {
-		writeError(w, err)
+		writeError(w, r, err)
 		return
 	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
-		"user": user,
+		"team": team,
 	})
 }
 
-// GET /users/getReview?user_id=...
-func (h *Handler) handleUsersGetReview(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
+// POST /team/removeMember
+type teamRemoveMemberRequest struct {
+	TeamName string `json:"team_name"`
+	UserID   string `json:"user_id"`
+}
+
+func (h *Handler) handleTeamRemoveMember(w http.ResponseWriter, r *http.Request) {
+	var req teamRemoveMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
 			Error: model.ErrorDetail{
 				Code:    model.ErrorCodeNotFound,
-				Message: "user_id is required",
+				Message: "invalid json",
 			},
 		})
 		return
 	}
 
-	id, prs, err := h.svc.GetUserReviews(r.Context(), userID)
+	res, err := h.svc.RemoveTeamMember(r.Context(), req.TeamName, req.UserID)
 	if err != nil {
-		writeError(w, err)
+		writeError(w, r, err)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{
-		"user_id":       id,
-		"pull_requests": prs,
-	})
+	writeJSON(w, http.StatusOK, res)
 }
 
-// POST /pullRequest/create
-type createPRRequest struct {
-	ID       string `json:"pull_request_id"`
-	Name     string `json:"pull_request_name"`
-	AuthorID string `json:"author_id"`
+// POST /team/moveMember
+type teamMoveMemberRequest struct {
+	UserID     string `json:"user_id"`
+	ToTeamName string `json:"to_team_name"`
 }
 
-func (h *Handler) handlePRCreate(w http.ResponseWriter, r *http.Request) {
-	var req createPRRequest
+func (h *Handler) handleTeamMoveMember(w http.ResponseWriter, r *http.Request) {
+	var req teamMoveMemberRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
 			Error: model.ErrorDetail{
@@ -223,28 +374,32 @@ func (h *Handler) handlePRCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pr, err := h.svc.CreatePR(r.Context(), service.CreatePRInput{
-		ID:       req.ID,
-		Name:     req.Name,
-		AuthorID: req.AuthorID,
-	})
+	if req.ToTeamName == "" {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "to_team_name is required",
+			},
+		})
+		return
+	}
+
+	res, err := h.svc.MoveUser(r.Context(), req.UserID, req.ToTeamName)
 	if err != nil {
-		writeError(w, err)
+		writeError(w, r, err)
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, map[string]any{
-		"pr": pr,
-	})
+	writeJSON(w, http.StatusOK, res)
 }
 
-// POST /pullRequest/merge
-type mergePRRequest struct {
-	ID string `json:"pull_request_id"`
+// POST /team/archive, /team/unarchive, /team/delete
+type teamNameRequest struct {
+	TeamName string `json:"team_name"`
 }
 
-func (h *Handler) handlePRMerge(w http.ResponseWriter, r *http.Request) {
-	var req mergePRRequest
+func decodeTeamName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req teamNameRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
 			Error: model.ErrorDetail{
@@ -252,29 +407,67 @@ func (h *Handler) handlePRMerge(w http.ResponseWriter, r *http.Request) {
 				Message: "invalid json",
 			},
 		})
+		return "", false
+	}
+	return req.TeamName, true
+}
+
+func (h *Handler) handleTeamArchive(w http.ResponseWriter, r *http.Request) {
+	teamName, ok := decodeTeamName(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := h.svc.ArchiveTeam(r.Context(), teamName)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h *Handler) handleTeamUnarchive(w http.ResponseWriter, r *http.Request) {
+	teamName, ok := decodeTeamName(w, r)
+	if !ok {
 		return
 	}
 
-	pr, err := h.svc.MergePR(r.Context(), req.ID)
+	team, err := h.svc.UnarchiveTeam(r.Context(), teamName)
 	if err != nil {
-		writeError(w, err)
+		writeError(w, r, err)
 		return
 	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
-		"pr": pr,
+		"team": team,
 	})
 }
 
-// POST /pullRequest/reassign
-type reassignPRRequest struct {
-	PullRequestID string `json:"pull_request_id"`
-	OldUserID     string `json:"old_user_id"`
-	OldReviewerID string `json:"old_reviewer_id"` // из-за example
+func (h *Handler) handleTeamDelete(w http.ResponseWriter, r *http.Request) {
+	teamName, ok := decodeTeamName(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := h.svc.DeleteTeam(r.Context(), teamName)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res)
 }
 
-func (h *Handler) handlePRReassign(w http.ResponseWriter, r *http.Request) {
-	var req reassignPRRequest
+// POST /team/setCodeOwners
+type setCodeOwnersRequest struct {
+	TeamName string               `json:"team_name"`
+	Rules    string               `json:"rules"`
+	Mode     model.CodeOwnersMode `json:"mode"`
+}
+
+func (h *Handler) handleTeamSetCodeOwners(w http.ResponseWriter, r *http.Request) {
+	var req setCodeOwnersRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
 			Error: model.ErrorDetail{
@@ -285,35 +478,722 @@ func (h *Handler) handlePRReassign(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.OldUserID == "" {
-		req.OldUserID = req.OldReviewerID
+	if req.Mode == "" {
+		req.Mode = model.CodeOwnersPrefer
+	}
+	if req.Mode != model.CodeOwnersPrefer && req.Mode != model.CodeOwnersRequire {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "mode must be prefer or require",
+			},
+		})
+		return
+	}
+	if _, err := codeowners.Parse(req.Rules); err != nil {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "invalid rules: " + err.Error(),
+			},
+		})
+		return
 	}
 
-	res, err := h.svc.ReassignReviewer(r.Context(), req.PullRequestID, req.OldUserID)
+	co, err := h.svc.SetCodeOwners(r.Context(), req.TeamName, model.CodeOwners{
+		Rules: req.Rules,
+		Mode:  req.Mode,
+	})
 	if err != nil {
-		writeError(w, err)
+		writeError(w, r, err)
 		return
 	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
-		"pr":          res.PR,
-		"replaced_by": res.ReplacedBy,
+		"team_name":   req.TeamName,
+		"code_owners": co,
 	})
 }
 
-// GET /stats/reviewers
-func (h *Handler) handleStatsReviewers(w http.ResponseWriter, r *http.Request) {
-	stats, err := h.svc.GetReviewerStats(r.Context())
+// GET /team/getCodeOwners?team_name=
+func (h *Handler) handleTeamGetCodeOwners(w http.ResponseWriter, r *http.Request) {
+	teamName := r.URL.Query().Get("team_name")
+	if teamName == "" {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "team_name is required",
+			},
+		})
+		return
+	}
+
+	co, err := h.svc.GetCodeOwners(r.Context(), teamName)
 	if err != nil {
-		writeError(w, err)
+		writeError(w, r, err)
 		return
 	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
-		"items": stats,
+		"team_name":   teamName,
+		"code_owners": co,
+	})
+}
+
+// POST /users/setIsActive
+type setIsActiveRequest struct {
+	UserID   string `json:"user_id"`
+	IsActive bool   `json:"is_active"`
+}
+
+type teamDeactivateRequest struct {
+	TeamName string   `json:"team_name"`
+	UserIDs  []string `json:"user_ids"`
+	DryRun   bool     `json:"dry_run"`
+}
+
+type teamDeactivateResponse struct {
+	TeamName             string                   `json:"team_name"`
+	DryRun               bool                     `json:"dry_run"`
+	Deactivated          []string                 `json:"deactivated"`
+	ReassignedReviewers  int                      `json:"reassigned_reviewers"`
+	RemovedReviewers     int                      `json:"removed_reviewers"`
+	AffectedPullRequests int                      `json:"affected_pull_requests"`
+	Changes              []service.ReviewerChange `json:"changes"`
+}
+
+func (h *Handler) handleUsersSetIsActive(w http.ResponseWriter, r *http.Request) {
+	var req setIsActiveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "invalid json",
+			},
+		})
+		return
+	}
+
+	user, err := h.svc.SetUserIsActive(r.Context(), req.UserID, req.IsActive)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"user": user,
 	})
 }
 
+// POST /users/rename
+type renameUserRequest struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+}
+
+func (h *Handler) handleUsersRename(w http.ResponseWriter, r *http.Request) {
+	var req renameUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "invalid json",
+			},
+		})
+		return
+	}
+
+	if req.Username == "" {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "username is required",
+			},
+		})
+		return
+	}
+
+	user, err := h.svc.RenameUser(r.Context(), req.UserID, req.Username)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"user": user,
+	})
+}
+
+// POST /users/setTags
+type setTagsRequest struct {
+	UserID string   `json:"user_id"`
+	Tags   []string `json:"tags"`
+}
+
+func (h *Handler) handleUsersSetTags(w http.ResponseWriter, r *http.Request) {
+	var req setTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "invalid json",
+			},
+		})
+		return
+	}
+
+	user, err := h.svc.SetUserTags(r.Context(), req.UserID, append([]string{}, req.Tags...))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"user": user,
+	})
+}
+
+// POST /users/setCapacity
+type setCapacityRequest struct {
+	UserID string `json:"user_id"`
+	// MaxOpenReviews is the limit of open reviews; null removes it.
+	MaxOpenReviews *int `json:"max_open_reviews"`
+}
+
+func (h *Handler) handleUsersSetCapacity(w http.ResponseWriter, r *http.Request) {
+	var req setCapacityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "invalid json",
+			},
+		})
+		return
+	}
+
+	if req.MaxOpenReviews != nil && *req.MaxOpenReviews < 0 {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "max_open_reviews must be non-negative",
+			},
+		})
+		return
+	}
+
+	user, err := h.svc.SetUserCapacity(r.Context(), req.UserID, req.MaxOpenReviews)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"user": user,
+	})
+}
+
+// GET /users/getReview?user_id=...
+func (h *Handler) handleUsersGetReview(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "user_id is required",
+			},
+		})
+		return
+	}
+
+	id, prs, err := h.svc.GetUserReviews(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"user_id":       id,
+		"pull_requests": prs,
+	})
+}
+
+// POST /users/setAbsence
+type setAbsenceRequest struct {
+	UserID   string          `json:"user_id"`
+	Absences []model.Absence `json:"absences"`
+}
+
+func (h *Handler) handleUsersSetAbsence(w http.ResponseWriter, r *http.Request) {
+	var req setAbsenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "invalid json",
+			},
+		})
+		return
+	}
+
+	for _, a := range req.Absences {
+		if !a.EndsAt.After(a.StartsAt) {
+			writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+				Error: model.ErrorDetail{
+					Code:    model.ErrorCodeNotFound,
+					Message: "ends_at must be after starts_at",
+				},
+			})
+			return
+		}
+	}
+
+	changes, err := h.svc.SetUserAbsences(r.Context(), req.UserID, req.Absences)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	absences, err := h.svc.GetUserAbsences(r.Context(), req.UserID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"user_id":  req.UserID,
+		"absences": absences,
+		"changes":  changes,
+	})
+}
+
+// GET /users/getAbsence?user_id=...
+func (h *Handler) handleUsersGetAbsence(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "user_id is required",
+			},
+		})
+		return
+	}
+
+	absences, err := h.svc.GetUserAbsences(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"user_id":  userID,
+		"absences": absences,
+	})
+}
+
+// POST /pullRequest/create
+type createPRRequest struct {
+	ID       string `json:"pull_request_id"`
+	Name     string `json:"pull_request_name"`
+	AuthorID string `json:"author_id"`
+	Draft    bool   `json:"draft"`
+	// ChangedFiles are matched against the code owners of the author's team.
+	ChangedFiles []string `json:"changed_files"`
+	// RequiredTags are skills that some reviewer should have.
+	RequiredTags []string `json:"required_tags"`
+}
+
+func (h *Handler) handlePRCreate(w http.ResponseWriter, r *http.Request) {
+	var req createPRRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "invalid json",
+			},
+		})
+		return
+	}
+
+	pr, err := h.svc.CreatePR(r.Context(), service.CreatePRInput{
+		ID:           req.ID,
+		Name:         req.Name,
+		AuthorID:     req.AuthorID,
+		Draft:        req.Draft,
+		ChangedFiles: req.ChangedFiles,
+		RequiredTags: req.RequiredTags,
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"pr": pr,
+	})
+}
+
+// POST /pullRequest/merge
+type mergePRRequest struct {
+	ID    string `json:"pull_request_id"`
+	Force bool   `json:"force"`
+	// ForcedBy is the user forcing the merge, required with Force.
+	ForcedBy string `json:"forced_by"`
+}
+
+func (h *Handler) handlePRMerge(w http.ResponseWriter, r *http.Request) {
+	var req mergePRRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "invalid json",
+			},
+		})
+		return
+	}
+
+	forcedBy := ""
+	if req.Force {
+		if req.ForcedBy == "" {
+			writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+				Error: model.ErrorDetail{
+					Code:    model.ErrorCodeNotFound,
+					Message: "forced_by is required with force",
+				},
+			})
+			return
+		}
+		forcedBy = req.ForcedBy
+	}
+
+	pr, err := h.svc.MergePR(r.Context(), req.ID, forcedBy)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"pr": pr,
+	})
+}
+
+type prStatusRequest struct {
+	ID string `json:"pull_request_id"`
+}
+
+// POST /pullRequest/close
+func (h *Handler) handlePRClose(w http.ResponseWriter, r *http.Request) {
+	h.handlePRStatusChange(w, r, h.svc.ClosePR)
+}
+
+// POST /pullRequest/reopen
+func (h *Handler) handlePRReopen(w http.ResponseWriter, r *http.Request) {
+	h.handlePRStatusChange(w, r, h.svc.ReopenPR)
+}
+
+// POST /pullRequest/markReady
+func (h *Handler) handlePRMarkReady(w http.ResponseWriter, r *http.Request) {
+	h.handlePRStatusChange(w, r, h.svc.MarkPRReady)
+}
+
+func (h *Handler) handlePRStatusChange(
+	w http.ResponseWriter,
+	r *http.Request,
+	change func(ctx context.Context, prID string) (model.PullRequest, error),
+) {
+	var req prStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "invalid json",
+			},
+		})
+		return
+	}
+
+	pr, err := change(r.Context(), req.ID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"pr": pr,
+	})
+}
+
+// POST /pullRequest/reassign
+type reassignPRRequest struct {
+	PullRequestID string `json:"pull_request_id"`
+	OldUserID     string `json:"old_user_id"`
+	OldReviewerID string `json:"old_reviewer_id"` // из-за example
+}
+
+func (h *Handler) handlePRReassign(w http.ResponseWriter, r *http.Request) {
+	var req reassignPRRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "invalid json",
+			},
+		})
+		return
+	}
+
+	if req.OldUserID == "" {
+		req.OldUserID = req.OldReviewerID
+	}
+
+	res, err := h.svc.ReassignReviewer(r.Context(), req.PullRequestID, req.OldUserID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"pr":          res.PR,
+		"replaced_by": res.ReplacedBy,
+	})
+}
+
+// POST /pullRequest/review
+type reviewPRRequest struct {
+	PullRequestID string            `json:"pull_request_id"`
+	ReviewerID    string            `json:"reviewer_id"`
+	Decision      model.ReviewState `json:"decision"`
+}
+
+func (h *Handler) handlePRReview(w http.ResponseWriter, r *http.Request) {
+	var req reviewPRRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "invalid json",
+			},
+		})
+		return
+	}
+
+	switch req.Decision {
+	case model.ReviewApproved, model.ReviewChangesRequested, model.ReviewCommented:
+	default:
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "decision must be one of APPROVED, CHANGES_REQUESTED, COMMENTED",
+			},
+		})
+		return
+	}
+
+	pr, err := h.svc.SubmitReview(r.Context(), req.PullRequestID, req.ReviewerID, req.Decision)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"pr": pr,
+	})
+}
+
+// parseTimeParam reads an optional query parameter in RFC 3339 or
+// YYYY-MM-DD form. On a bad value it writes the error and returns false.
+func parseTimeParam(w http.ResponseWriter, r *http.Request, name string) (*time.Time, bool) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return nil, true
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		t, err = time.Parse(time.DateOnly, raw)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: name + " must be an RFC 3339 time or a YYYY-MM-DD date",
+			},
+		})
+		return nil, false
+	}
+	return &t, true
+}
+
+// parseTimeRange reads the optional from and to query parameters and checks
+// that from is before to. On a bad value it writes the error and returns false.
+func parseTimeRange(w http.ResponseWriter, r *http.Request) (from, to *time.Time, ok bool) {
+	if from, ok = parseTimeParam(w, r, "from"); !ok {
+		return nil, nil, false
+	}
+	if to, ok = parseTimeParam(w, r, "to"); !ok {
+		return nil, nil, false
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "from must be before to",
+			},
+		})
+		return nil, nil, false
+	}
+	return from, to, true
+}
+
+// GET /stats/reviewers?from=&to=&team_name=&status=
+func (h *Handler) handleStatsReviewers(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return
+	}
+
+	status := model.PullRequestStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", model.StatusDraft, model.StatusOpen, model.StatusMerged, model.StatusClosed:
+	default:
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "status must be DRAFT, OPEN, MERGED or CLOSED",
+			},
+		})
+		return
+	}
+
+	stats, err := h.svc.GetReviewerStats(r.Context(), model.ReviewerStatsFilter{
+		From:     from,
+		To:       to,
+		TeamName: r.URL.Query().Get("team_name"),
+		Status:   status,
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items": stats,
+	})
+}
+
+// GET /stats/pullRequests?from=&to=&team_name=
+func (h *Handler) handleStatsPullRequests(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return
+	}
+	end := time.Now()
+	if to != nil {
+		end = *to
+	}
+	if from != nil && end.Sub(*from) > service.MaxPRStatsWindow {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "period must not be longer than 366 days",
+			},
+		})
+		return
+	}
+
+	stats, err := h.svc.GetPRStats(r.Context(), from, to, r.URL.Query().Get("team_name"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// GET /stats/fairness?team_name=&from=&to=&threshold=
+func (h *Handler) handleStatsFairness(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return
+	}
+
+	threshold := service.DefaultFairnessThreshold
+	if raw := r.URL.Query().Get("threshold"); raw != "" {
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v < 0 {
+			writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+				Error: model.ErrorDetail{
+					Code:    model.ErrorCodeNotFound,
+					Message: "threshold must be a non-negative number, e.g. 0.5",
+				},
+			})
+			return
+		}
+		threshold = v
+	}
+
+	report, err := h.svc.GetFairness(r.Context(), r.URL.Query().Get("team_name"), from, to, threshold)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items": report,
+	})
+}
+
+// GET /stats/teams?team_name=...
+func (h *Handler) handleStatsTeams(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.svc.GetTeamStats(r.Context(), r.URL.Query().Get("team_name"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items": stats,
+	})
+}
+
+// GET /stats/pairings?team_name=&window=
+func (h *Handler) handleStatsPairings(w http.ResponseWriter, r *http.Request) {
+	teamName := r.URL.Query().Get("team_name")
+	if teamName == "" {
+		writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Code:    model.ErrorCodeNotFound,
+				Message: "team_name is required",
+			},
+		})
+		return
+	}
+
+	window := h.svc.PairWindow()
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		v, err := time.ParseDuration(raw)
+		if err != nil || v < 0 {
+			writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+				Error: model.ErrorDetail{
+					Code:    model.ErrorCodeNotFound,
+					Message: "window must be a non-negative duration, e.g. 720h",
+				},
+			})
+			return
+		}
+		window = v
+	}
+
+	matrix, err := h.svc.GetPairingMatrix(r.Context(), teamName, window)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, matrix)
+}
+
 // POST /team/deactivateAndReassign
 func (h *Handler) handleTeamDeactivateAndReassign(w http.ResponseWriter, r *http.Request) {
 	var req teamDeactivateRequest
@@ -337,17 +1217,19 @@ func (h *Handler) handleTeamDeactivateAndReassign(w http.ResponseWriter, r *http
 		return
 	}
 
-	res, err := h.svc.DeactivateTeamUsersAndReassign(r.Context(), req.TeamName, req.UserIDs)
+	res, err := h.svc.DeactivateTeamUsersAndReassign(r.Context(), req.TeamName, req.UserIDs, req.DryRun)
 	if err != nil {
-		writeError(w, err)
+		writeError(w, r, err)
 		return
 	}
 
 	writeJSON(w, http.StatusOK, teamDeactivateResponse{
 		TeamName:             res.TeamName,
+		DryRun:               res.DryRun,
 		Deactivated:          res.Deactivated,
 		ReassignedReviewers:  res.ReassignedReviewers,
 		RemovedReviewers:     res.RemovedReviewers,
 		AffectedPullRequests: res.AffectedPullRequests,
+		Changes:              res.Changes,
 	})
 }
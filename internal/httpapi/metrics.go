@@ -0,0 +1,33 @@
+package httpapi
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Mavichy/AvitoNovember/internal/metrics"
+)
+
+type httpMetrics struct {
+	requests     *metrics.CounterVec
+	duration     *metrics.HistogramVec
+	domainErrors *metrics.CounterVec
+}
+
+func newHTTPMetrics(reg *metrics.Registry) *httpMetrics {
+	return &httpMetrics{
+		requests: reg.NewCounterVec("http_requests_total",
+			"HTTP requests by route, method and status code.", "route", "method", "code"),
+		duration: reg.NewHistogramVec("http_request_duration_seconds",
+			"HTTP request latency by route and method.", metrics.DefBuckets, "route", "method"),
+		domainErrors: reg.NewCounterVec("domain_errors_total",
+			"Domain errors returned to clients by route and error code.", "route", "code"),
+	}
+}
+
+func (m *httpMetrics) observe(rec *statusRecorder, method, route string, elapsed time.Duration) {
+	m.requests.Inc(route, method, strconv.Itoa(rec.status))
+	m.duration.Observe(elapsed.Seconds(), route, method)
+	if rec.errorCode != "" {
+		m.domainErrors.Inc(route, string(rec.errorCode))
+	}
+}
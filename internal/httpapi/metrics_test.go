@@ -0,0 +1,62 @@
+package httpapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Mavichy/AvitoNovember/internal/metrics"
+	"github.com/Mavichy/AvitoNovember/internal/repository"
+	"github.com/Mavichy/AvitoNovember/internal/service"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	svc := service.NewService(repository.NewMemoryRepository())
+	srv := httptest.NewServer(NewHandler(svc, metrics.NewRegistry()))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func do(t *testing.T, srv *httptest.Server, method, path, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestHTTPMetrics(t *testing.T) {
+	srv := newTestServer(t)
+
+	do(t, srv, "POST", "/team/add", `{"team_name":"backend","members":[{"user_id":"u1","username":"a","is_active":true}]}`)
+	do(t, srv, "GET", "/team/get?team_name=backend", "")
+	do(t, srv, "GET", "/team/get?team_name=nope", "")
+	do(t, srv, "GET", "/no/such/path", "")
+
+	resp := do(t, srv, "GET", "/metrics", "")
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`http_requests_total{route="/team/add",method="POST",code="201"} 1`,
+		`http_requests_total{route="/team/get",method="GET",code="200"} 1`,
+		`http_requests_total{route="/team/get",method="GET",code="404"} 1`,
+		`http_requests_total{route="other",method="GET",code="404"} 1`,
+		`domain_errors_total{route="/team/get",code="NOT_FOUND"} 1`,
+		`http_request_duration_seconds_count{route="/team/get",method="GET"} 2`,
+	} {
+		if !strings.Contains(string(body), want+"\n") {
+			t.Errorf("metrics have no %s", want)
+		}
+	}
+}
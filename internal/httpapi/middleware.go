@@ -0,0 +1,102 @@
+package httpapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Mavichy/AvitoNovember/internal/logging"
+	"github.com/Mavichy/AvitoNovember/internal/model"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen bounds client-supplied request IDs; longer ones are
+// replaced with a generated ID.
+const maxRequestIDLen = 128
+
+// statusRecorder remembers the status and the domain error code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status    int
+	errorCode model.ErrorCode
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// recordErrorCode marks the response as a domain error for the metrics.
+func recordErrorCode(w http.ResponseWriter, code model.ErrorCode) {
+	if rec, ok := w.(*statusRecorder); ok {
+		rec.errorCode = code
+	}
+}
+
+// serve wraps mux with request IDs, access logs and, if m is not nil,
+// metrics. The request ID is taken from X-Request-ID or generated, echoed
+// back in the response and stored in the request context together with a
+// logger that adds it to every record.
+func serve(mux *http.ServeMux, m *httpMetrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLen {
+			requestID = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+		r = r.WithContext(logging.WithRequestID(r.Context(), requestID))
+
+		// Routes are labelled by their registered pattern so unknown paths
+		// do not blow up the number of metric series.
+		route := "other"
+		if _, pattern := mux.Handler(r); pattern != "" {
+			route = pattern
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		mux.ServeHTTP(rec, r)
+		elapsed := time.Since(start)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		if m != nil {
+			m.observe(rec, r.Method, route, elapsed)
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", route),
+			slog.Int("status", rec.status),
+			slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+		}
+		if rec.errorCode != "" {
+			attrs = append(attrs, slog.String("error_code", string(rec.errorCode)))
+		}
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logging.FromContext(r.Context()).LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,141 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Mavichy/AvitoNovember/internal/logging"
+	"github.com/Mavichy/AvitoNovember/internal/model"
+	"github.com/Mavichy/AvitoNovember/internal/repository"
+	"github.com/Mavichy/AvitoNovember/internal/service"
+)
+
+// brokenStore fails every team lookup, as an unavailable database would.
+type brokenStore struct {
+	*repository.MemoryRepository
+}
+
+func (brokenStore) GetTeam(ctx context.Context, teamName string) (model.Team, error) {
+	return model.Team{}, errors.New("connection refused")
+}
+
+// serveLogged serves one request and returns the response and the JSON log
+// records written while handling it.
+func serveLogged(t *testing.T, h http.Handler, req *http.Request) (*httptest.ResponseRecorder, []map[string]any) {
+	t.Helper()
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req.WithContext(logging.WithLogger(req.Context(), logger)))
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+	return rec, records
+}
+
+func TestRequestID(t *testing.T) {
+	h := NewHandler(service.NewService(repository.NewMemoryRepository()), nil)
+
+	tests := []struct {
+		name, header string
+		keep         bool
+	}{
+		{"supplied", "req-1", true},
+		{"missing", "", false},
+		{"too long", strings.Repeat("x", maxRequestIDLen+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/team/get?team_name=nope", nil)
+			if tt.header != "" {
+				req.Header.Set(requestIDHeader, tt.header)
+			}
+			rec, records := serveLogged(t, h, req)
+
+			id := rec.Header().Get(requestIDHeader)
+			if tt.keep && id != tt.header || !tt.keep && len(id) != 32 {
+				t.Fatalf("request ID = %q", id)
+			}
+			if len(records) != 1 {
+				t.Fatalf("records = %v", records)
+			}
+			want := map[string]any{
+				"level": "INFO", "msg": "request", "request_id": id, "method": "GET",
+				"route": "/team/get", "status": float64(404), "error_code": "NOT_FOUND",
+			}
+			for k, v := range want {
+				if records[0][k] != v {
+					t.Errorf("%s = %v, want %v", k, records[0][k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestInternalErrorIsLogged(t *testing.T) {
+	h := NewHandler(service.NewService(brokenStore{repository.NewMemoryRepository()}), nil)
+	req := httptest.NewRequest("GET", "/team/get?team_name=backend", nil)
+	req.Header.Set(requestIDHeader, "req-500")
+	rec, records := serveLogged(t, h, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	// The cause is logged, not returned to the client.
+	if strings.Contains(rec.Body.String(), "connection refused") {
+		t.Fatalf("body leaks the cause: %s", rec.Body.String())
+	}
+	if len(records) != 2 {
+		t.Fatalf("records = %v", records)
+	}
+	for i, want := range []map[string]any{
+		{"level": "ERROR", "msg": "internal server error", "request_id": "req-500", "error": "connection refused"},
+		{"level": "ERROR", "msg": "request", "request_id": "req-500", "status": float64(500)},
+	} {
+		for k, v := range want {
+			if records[i][k] != v {
+				t.Errorf("record %d: %s = %v, want %v", i, k, records[i][k], v)
+			}
+		}
+	}
+}
+
+func TestServiceLogsCarryRequestID(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository())
+	h := NewHandler(svc, nil)
+	ctx := context.Background()
+	if _, err := svc.AddTeam(ctx, model.Team{TeamName: "backend", Members: []model.TeamMember{
+		{UserID: "a", Username: "a", IsActive: true},
+		{UserID: "b", Username: "b", IsActive: true},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.CreatePR(ctx, service.CreatePRInput{ID: "p", Name: "p", AuthorID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/pullRequest/reassign", strings.NewReader(`{"pull_request_id":"p","old_user_id":"b"}`))
+	req.Header.Set(requestIDHeader, "req-warn")
+	rec, records := serveLogged(t, h, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	if len(records) != 2 || records[0]["msg"] != "no reviewer selected" ||
+		records[0]["level"] != "WARN" || records[0]["request_id"] != "req-warn" {
+		t.Fatalf("records = %v", records)
+	}
+}
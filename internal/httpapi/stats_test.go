@@ -0,0 +1,31 @@
+package httpapi
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestStatsTimeRange(t *testing.T) {
+	srv := newTestServer(t)
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"", http.StatusOK},
+		{"?from=2026-09-01&to=2026-10-01", http.StatusOK},
+		{"?from=2026-09-01T00:00:00Z", http.StatusOK},
+		{"?from=2026-10-01&to=2026-09-01", http.StatusBadRequest},
+		{"?from=2026-10-01&to=2026-10-01", http.StatusBadRequest},
+		{"?from=yesterday", http.StatusBadRequest},
+		{"?status=WAITING", http.StatusBadRequest},
+		{"?team_name=nope", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := do(t, srv, "GET", "/stats/reviewers"+tt.query, "").StatusCode; got != tt.want {
+				t.Fatalf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -11,6 +11,24 @@ const (
 	ErrorCodeNotAssigned ErrorCode = "NOT_ASSIGNED"
 	ErrorCodeNoCandidate ErrorCode = "NO_CANDIDATE"
 	ErrorCodeNotFound    ErrorCode = "NOT_FOUND"
+	// ErrorCodeMergeBlocked means the team's approval policy is not satisfied.
+	ErrorCodeMergeBlocked ErrorCode = "MERGE_BLOCKED"
+	// ErrorCodeInvalidTransition means the PR status change is not allowed.
+	ErrorCodeInvalidTransition ErrorCode = "INVALID_TRANSITION"
+	// ErrorCodePRNotOpen means the operation needs an OPEN pull request.
+	ErrorCodePRNotOpen ErrorCode = "PR_NOT_OPEN"
+	// ErrorCodeUserInOtherTeam means the user has to be moved from their
+	// current team explicitly.
+	ErrorCodeUserInOtherTeam ErrorCode = "USER_IN_OTHER_TEAM"
+	// ErrorCodeTeamArchived means the team is archived and read-only.
+	ErrorCodeTeamArchived ErrorCode = "TEAM_ARCHIVED"
+	// ErrorCodeTeamNotArchived means the team has to be archived first.
+	ErrorCodeTeamNotArchived ErrorCode = "TEAM_NOT_ARCHIVED"
+	// ErrorCodeInvalidHierarchy means the parent team would create a cycle.
+	ErrorCodeInvalidHierarchy ErrorCode = "INVALID_HIERARCHY"
+	// ErrorCodeNoCodeOwner means a changed path requires an owner and none
+	// is available.
+	ErrorCodeNoCodeOwner ErrorCode = "NO_CODE_OWNER"
 )
 
 type ErrorDetail struct {
@@ -26,11 +44,33 @@ type TeamMember struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
 	IsActive bool   `json:"is_active"`
+	// Tags are the member's skills; nil keeps the tags of an existing user.
+	Tags []string `json:"tags,omitempty"`
+}
+
+type TeamSettings struct {
+	ReviewerCount int `json:"reviewer_count"`
+	// RequiredApprovals is the number of approvals needed to merge; 0 disables the check.
+	RequiredApprovals int `json:"required_approvals"`
+	// ClimbHierarchy lets reviewer selection go up to the parent teams and
+	// their subteams when the team and its fallbacks run short.
+	ClimbHierarchy bool `json:"climb_hierarchy"`
 }
 
 type Team struct {
-	TeamName string       `json:"team_name"`
-	Members  []TeamMember `json:"members"`
+	TeamName string `json:"team_name"`
+	// ParentTeam is the enclosing team (e.g. the department of a squad).
+	ParentTeam string `json:"parent_team,omitempty"`
+	TeamSettings
+	// ArchivedAt is set once the team is archived: it keeps its history but
+	// its members can no longer open pull requests.
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+	// FallbackTeams are used in order when the team itself cannot supply
+	// enough reviewers.
+	FallbackTeams []string     `json:"fallback_teams,omitempty"`
+	Members       []TeamMember `json:"members"`
+	// Subteams is filled only on request, recursively.
+	Subteams []Team `json:"subteams,omitempty"`
 }
 
 type User struct {
@@ -38,6 +78,37 @@ type User struct {
 	Username string `json:"username"`
 	TeamName string `json:"team_name"`
 	IsActive bool   `json:"is_active"`
+	// MaxOpenReviews limits how many OPEN pull requests the user reviews at
+	// once. Nil means no limit.
+	MaxOpenReviews *int `json:"max_open_reviews,omitempty"`
+	// Tags are the user's skills (e.g. go, postgres), matched against the
+	// required tags of pull requests.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Absence is a period when the user is unavailable for reviews.
+// StartsAt is inclusive, EndsAt is exclusive.
+type Absence struct {
+	ID       int64     `json:"-"`
+	UserID   string    `json:"-"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	Reason   string    `json:"reason,omitempty"`
+}
+
+type CodeOwnersMode string
+
+const (
+	// CodeOwnersPrefer assigns owners of the changed paths when available.
+	CodeOwnersPrefer CodeOwnersMode = "prefer"
+	// CodeOwnersRequire fails the assignment if some owned path gets no owner.
+	CodeOwnersRequire CodeOwnersMode = "require"
+)
+
+// CodeOwners are a team's ownership rules in CODEOWNERS syntax.
+type CodeOwners struct {
+	Rules string         `json:"rules"`
+	Mode  CodeOwnersMode `json:"mode"`
 }
 
 type PullRequestStatus string
@@ -45,16 +116,48 @@ type PullRequestStatus string
 const (
 	StatusOpen   PullRequestStatus = "OPEN"
 	StatusMerged PullRequestStatus = "MERGED"
+	StatusClosed PullRequestStatus = "CLOSED"
+	StatusDraft  PullRequestStatus = "DRAFT"
 )
 
+type ReviewState string
+
+const (
+	ReviewPending          ReviewState = "PENDING"
+	ReviewApproved         ReviewState = "APPROVED"
+	ReviewChangesRequested ReviewState = "CHANGES_REQUESTED"
+	ReviewCommented        ReviewState = "COMMENTED"
+)
+
+type Review struct {
+	ReviewerID string      `json:"reviewer_id"`
+	State      ReviewState `json:"state"`
+	AssignedAt *time.Time  `json:"assignedAt,omitempty"`
+	ReviewedAt *time.Time  `json:"reviewedAt,omitempty"`
+	// SourceTeam is the team whose pool the reviewer was picked from: the
+	// author's team or one of its fallback teams.
+	SourceTeam string `json:"source_team,omitempty"`
+}
+
 type PullRequest struct {
 	ID                string            `json:"pull_request_id"`
 	Name              string            `json:"pull_request_name"`
 	AuthorID          string            `json:"author_id"`
 	Status            PullRequestStatus `json:"status"`
 	AssignedReviewers []string          `json:"assigned_reviewers"`
+	Reviews           []Review          `json:"reviews"`
 	CreatedAt         *time.Time        `json:"createdAt,omitempty"`
 	MergedAt          *time.Time        `json:"mergedAt,omitempty"`
+	ClosedAt          *time.Time        `json:"closedAt,omitempty"`
+	// ForceMerged records that the merge bypassed the approval policy;
+	// ForcedBy and ForcedAt say who did it and when.
+	ForceMerged bool       `json:"forceMerged,omitempty"`
+	ForcedBy    string     `json:"forcedBy,omitempty"`
+	ForcedAt    *time.Time `json:"forcedAt,omitempty"`
+	// ChangedFiles are the paths touched by the PR, used for code owners.
+	ChangedFiles []string `json:"changed_files,omitempty"`
+	// RequiredTags should each be covered by at least one reviewer.
+	RequiredTags []string `json:"required_tags,omitempty"`
 }
 
 type PullRequestShort struct {
@@ -65,6 +168,49 @@ type PullRequestShort struct {
 }
 
 type ReviewerStatsItem struct {
-	UserID      string `json:"user_id"`
-	ReviewCount int    `json:"review_count"`
+	UserID   string `json:"user_id"`
+	TeamName string `json:"team_name,omitempty"`
+	IsActive bool   `json:"is_active"`
+	// ReviewCount is the number of assignments matching the filter.
+	ReviewCount int `json:"review_count"`
+	// OpenCount counts assignments on OPEN pull requests, CompletedCount
+	// those on MERGED or CLOSED ones.
+	OpenCount      int `json:"open_count"`
+	CompletedCount int `json:"completed_count"`
+}
+
+// ReviewerStatsFilter narrows reviewer stats. Zero fields do not filter.
+// From and To bound the assignment time, To is exclusive.
+type ReviewerStatsFilter struct {
+	From     *time.Time
+	To       *time.Time
+	TeamName string
+	Status   PullRequestStatus
+}
+
+// PRTimes are the timestamps of a pull request used for latency stats.
+// TeamName is the author's current team.
+type PRTimes struct {
+	ID        string
+	AuthorID  string
+	TeamName  string
+	Status    PullRequestStatus
+	CreatedAt time.Time
+	MergedAt  *time.Time
+}
+
+// PairCount is how many times ReviewerID was assigned to AuthorID's PRs.
+type PairCount struct {
+	AuthorID   string `json:"author_id"`
+	ReviewerID string `json:"reviewer_id"`
+	Count      int    `json:"count"`
+}
+
+// PairingMatrix holds author→reviewer assignment counts for the members of
+// a team, rows are authors. Since is nil when all history is counted.
+type PairingMatrix struct {
+	TeamName string                    `json:"team_name"`
+	Since    *time.Time                `json:"since,omitempty"`
+	Members  []string                  `json:"members"`
+	Matrix   map[string]map[string]int `json:"matrix"`
 }
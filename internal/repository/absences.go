@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+)
+
+// SetAbsences replaces the user's absence schedule.
+func (r *Repository) SetAbsences(ctx context.Context, userID string, absences []model.Absence) error {
+	return r.InTx(ctx, func(ctx context.Context) error {
+		if _, err := r.GetUser(ctx, userID); err != nil {
+			return err
+		}
+
+		if _, err := r.q(ctx).ExecContext(ctx,
+			"DELETE FROM user_absences WHERE user_id = $1", userID); err != nil {
+			return err
+		}
+
+		for _, a := range absences {
+			if _, err := r.q(ctx).ExecContext(ctx, `
+				INSERT INTO user_absences (user_id, starts_at, ends_at, reason)
+				VALUES ($1, $2, $3, $4)
+			`, userID, a.StartsAt, a.EndsAt, a.Reason); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *Repository) GetAbsences(ctx context.Context, userID string) ([]model.Absence, error) {
+	if _, err := r.GetUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.q(ctx).QueryContext(ctx, `
+		SELECT id, user_id, starts_at, ends_at, reason
+		FROM user_absences
+		WHERE user_id = $1
+		ORDER BY starts_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []model.Absence
+	for rows.Next() {
+		var a model.Absence
+		if err := rows.Scan(&a.ID, &a.UserID, &a.StartsAt, &a.EndsAt, &a.Reason); err != nil {
+			return nil, err
+		}
+		res = append(res, a)
+	}
+	return res, rows.Err()
+}
+
+func (r *Repository) GetUsersWithStartedAbsences(ctx context.Context) ([]string, error) {
+	rows, err := r.q(ctx).QueryContext(ctx, `
+		SELECT DISTINCT user_id
+		FROM user_absences
+		WHERE reassigned_at IS NULL AND starts_at <= now() AND ends_at > now()
+		ORDER BY user_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		res = append(res, id)
+	}
+	return res, rows.Err()
+}
+
+// ClaimStartedAbsences locks the absences of userID that are in progress and
+// whose reviews have not been reassigned yet. Rows locked by another
+// transaction are skipped, so several replicas can process absences
+// concurrently. Must run in a transaction.
+func (r *Repository) ClaimStartedAbsences(ctx context.Context, userID string) ([]model.Absence, error) {
+	rows, err := r.q(ctx).QueryContext(ctx, `
+		SELECT id, user_id, starts_at, ends_at, reason
+		FROM user_absences
+		WHERE user_id = $1 AND reassigned_at IS NULL AND starts_at <= now() AND ends_at > now()
+		ORDER BY starts_at, id
+		FOR UPDATE SKIP LOCKED
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []model.Absence
+	for rows.Next() {
+		var a model.Absence
+		if err := rows.Scan(&a.ID, &a.UserID, &a.StartsAt, &a.EndsAt, &a.Reason); err != nil {
+			return nil, err
+		}
+		res = append(res, a)
+	}
+	return res, rows.Err()
+}
+
+func (r *Repository) MarkAbsenceHandled(ctx context.Context, id int64) error {
+	_, err := r.q(ctx).ExecContext(ctx,
+		"UPDATE user_absences SET reassigned_at = now() WHERE id = $1", id)
+	return err
+}
@@ -0,0 +1,1077 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+)
+
+// MemoryRepository is a thread-safe in-memory implementation of the storage
+// used by the service. It keeps the same semantics and errors as Repository
+// and is meant for local runs, demos and tests without PostgreSQL.
+type MemoryRepository struct {
+	mu   sync.RWMutex
+	data *memoryData
+}
+
+type memoryData struct {
+	teams map[string]*memTeam
+	users map[string]*model.User
+	prs   map[string]*memPR
+	// absences are keyed by user id and ordered by StartsAt.
+	absences map[string][]memAbsence
+	// seq orders pull requests created within the same clock tick.
+	seq int64
+	// absenceSeq hands out absence ids.
+	absenceSeq int64
+}
+
+type memAbsence struct {
+	absence    model.Absence
+	reassigned bool
+}
+
+// started reports whether the absence is in progress at now and its reviews
+// have not been reassigned yet.
+func (a memAbsence) started(now time.Time) bool {
+	return !a.reassigned && !a.absence.StartsAt.After(now) && a.absence.EndsAt.After(now)
+}
+
+type memTeam struct {
+	name       string
+	settings   model.TeamSettings
+	archivedAt *time.Time
+	fallbacks  []string
+	parent     string
+	codeOwners *model.CodeOwners
+}
+
+type memPR struct {
+	pr        model.PullRequest
+	seq       int64
+	reviewers []model.Review
+}
+
+type memTxKey struct{}
+
+type memTx struct {
+	repo *MemoryRepository
+	data *memoryData
+}
+
+func newMemoryData() *memoryData {
+	return &memoryData{
+		teams:    make(map[string]*memTeam),
+		users:    make(map[string]*model.User),
+		prs:      make(map[string]*memPR),
+		absences: make(map[string][]memAbsence),
+	}
+}
+
+func (d *memoryData) clone() *memoryData {
+	c := newMemoryData()
+	c.seq = d.seq
+	c.absenceSeq = d.absenceSeq
+	for name, t := range d.teams {
+		tc := *t
+		tc.fallbacks = append([]string(nil), t.fallbacks...)
+		if t.codeOwners != nil {
+			co := *t.codeOwners
+			tc.codeOwners = &co
+		}
+		c.teams[name] = &tc
+	}
+	for id, u := range d.users {
+		uc := *u
+		uc.MaxOpenReviews = copyInt(u.MaxOpenReviews)
+		uc.Tags = append([]string(nil), u.Tags...)
+		c.users[id] = &uc
+	}
+	for id, p := range d.prs {
+		pc := *p
+		pc.reviewers = append([]model.Review(nil), p.reviewers...)
+		c.prs[id] = &pc
+	}
+	for id, as := range d.absences {
+		c.absences[id] = append([]memAbsence(nil), as...)
+	}
+	return c
+}
+
+// InTx runs fn against a private copy of the data while holding the write
+// lock, and publishes the copy only if fn succeeds. Transactions are
+// therefore serialized and fully rolled back on error.
+func (m *MemoryRepository) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if tx, ok := ctx.Value(memTxKey{}).(*memTx); ok && tx.repo == m {
+		return fn(ctx)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx := &memTx{repo: m, data: m.data.clone()}
+	if err := fn(context.WithValue(ctx, memTxKey{}, tx)); err != nil {
+		return err
+	}
+	m.data = tx.data
+	return nil
+}
+
+// lock returns the data to modify: the transaction copy when called inside
+// InTx (already exclusively held), otherwise the shared data under the write lock.
+func (m *MemoryRepository) lock(ctx context.Context) (*memoryData, func()) {
+	if tx, ok := ctx.Value(memTxKey{}).(*memTx); ok && tx.repo == m {
+		return tx.data, func() {}
+	}
+	m.mu.Lock()
+	return m.data, m.mu.Unlock
+}
+
+func (m *MemoryRepository) rlock(ctx context.Context) (*memoryData, func()) {
+	if tx, ok := ctx.Value(memTxKey{}).(*memTx); ok && tx.repo == m {
+		return tx.data, func() {}
+	}
+	m.mu.RLock()
+	return m.data, m.mu.RUnlock
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{data: newMemoryData()}
+}
+
+func (m *MemoryRepository) CreateTeam(ctx context.Context, team model.Team) error {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	if _, ok := d.teams[team.TeamName]; ok {
+		return ErrTeamExists
+	}
+
+	if err := d.checkMembers(team.TeamName, team.Members); err != nil {
+		return err
+	}
+	for _, fb := range team.FallbackTeams {
+		if _, ok := d.teams[fb]; !ok {
+			return ErrTeamNotFound
+		}
+	}
+	if _, ok := d.teams[team.ParentTeam]; team.ParentTeam != "" && !ok {
+		return ErrTeamNotFound
+	}
+
+	d.teams[team.TeamName] = &memTeam{
+		name:      team.TeamName,
+		settings:  team.TeamSettings,
+		fallbacks: append([]string(nil), team.FallbackTeams...),
+		parent:    team.ParentTeam,
+	}
+	d.upsertMembers(team.TeamName, team.Members)
+	return nil
+}
+
+func (m *MemoryRepository) AddTeamMembers(ctx context.Context, teamName string, members []model.TeamMember) error {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	if _, ok := d.teams[teamName]; !ok {
+		return ErrTeamNotFound
+	}
+	if err := d.checkMembers(teamName, members); err != nil {
+		return err
+	}
+	d.upsertMembers(teamName, members)
+	return nil
+}
+
+func (d *memoryData) checkMembers(teamName string, members []model.TeamMember) error {
+	for _, member := range members {
+		if u, ok := d.users[member.UserID]; ok && u.TeamName != "" && u.TeamName != teamName {
+			return fmt.Errorf("user %s: %w", member.UserID, ErrUserInOtherTeam)
+		}
+	}
+	return nil
+}
+
+func (d *memoryData) upsertMembers(teamName string, members []model.TeamMember) {
+	for _, member := range members {
+		u := &model.User{
+			UserID:   member.UserID,
+			Username: member.Username,
+			TeamName: teamName,
+			IsActive: member.IsActive,
+			Tags:     sortedUnique(member.Tags),
+		}
+		if old, ok := d.users[member.UserID]; ok {
+			u.MaxOpenReviews = old.MaxOpenReviews
+			if member.Tags == nil {
+				u.Tags = old.Tags
+			}
+		}
+		d.users[member.UserID] = u
+	}
+}
+
+func (m *MemoryRepository) GetTeamSettings(ctx context.Context, teamName string) (model.TeamSettings, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	t, ok := d.teams[teamName]
+	if !ok {
+		return model.TeamSettings{}, ErrTeamNotFound
+	}
+	return t.settings, nil
+}
+
+func (m *MemoryRepository) SetTeamSettings(ctx context.Context, teamName string, ts model.TeamSettings) error {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	t, ok := d.teams[teamName]
+	if !ok {
+		return ErrTeamNotFound
+	}
+	t.settings = ts
+	return nil
+}
+
+func (m *MemoryRepository) GetTeam(ctx context.Context, teamName string) (model.Team, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	t, ok := d.teams[teamName]
+	if !ok {
+		return model.Team{}, ErrTeamNotFound
+	}
+
+	var members []model.TeamMember
+	for _, u := range d.users {
+		if u.TeamName != teamName {
+			continue
+		}
+		members = append(members, model.TeamMember{
+			UserID:   u.UserID,
+			Username: u.Username,
+			IsActive: u.IsActive,
+			Tags:     append([]string(nil), u.Tags...),
+		})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].UserID < members[j].UserID })
+
+	return model.Team{
+		TeamName:      teamName,
+		ParentTeam:    t.parent,
+		TeamSettings:  t.settings,
+		ArchivedAt:    copyTime(t.archivedAt),
+		FallbackTeams: append([]string(nil), t.fallbacks...),
+		Members:       members,
+	}, nil
+}
+
+func (m *MemoryRepository) GetTeamFallbacks(ctx context.Context, teamName string) ([]string, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	t, ok := d.teams[teamName]
+	if !ok {
+		return nil, nil
+	}
+	return append([]string(nil), t.fallbacks...), nil
+}
+
+func (m *MemoryRepository) SetTeamFallbacks(ctx context.Context, teamName string, fallbacks []string) error {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	t, ok := d.teams[teamName]
+	if !ok {
+		return ErrTeamNotFound
+	}
+	for _, fb := range fallbacks {
+		if _, ok := d.teams[fb]; !ok {
+			return ErrTeamNotFound
+		}
+	}
+	t.fallbacks = append([]string(nil), fallbacks...)
+	return nil
+}
+
+func (m *MemoryRepository) GetTeamParent(ctx context.Context, teamName string) (string, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	t, ok := d.teams[teamName]
+	if !ok {
+		return "", ErrTeamNotFound
+	}
+	return t.parent, nil
+}
+
+func (m *MemoryRepository) SetTeamParent(ctx context.Context, teamName, parent string) error {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	t, ok := d.teams[teamName]
+	if !ok {
+		return ErrTeamNotFound
+	}
+	if _, ok := d.teams[parent]; parent != "" && !ok {
+		return ErrTeamNotFound
+	}
+	t.parent = parent
+	return nil
+}
+
+func (m *MemoryRepository) GetSubteams(ctx context.Context, parent string) ([]string, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	var res []string
+	for name, t := range d.teams {
+		if t.parent == parent {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (m *MemoryRepository) GetCodeOwners(ctx context.Context, teamName string) (model.CodeOwners, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	t, ok := d.teams[teamName]
+	if !ok {
+		return model.CodeOwners{}, ErrTeamNotFound
+	}
+	if t.codeOwners == nil {
+		return model.CodeOwners{Mode: model.CodeOwnersPrefer}, nil
+	}
+	return *t.codeOwners, nil
+}
+
+func (m *MemoryRepository) SetCodeOwners(ctx context.Context, teamName string, co model.CodeOwners) error {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	t, ok := d.teams[teamName]
+	if !ok {
+		return ErrTeamNotFound
+	}
+	t.codeOwners = &co
+	return nil
+}
+
+func (m *MemoryRepository) IsTeamArchived(ctx context.Context, teamName string) (bool, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	t, ok := d.teams[teamName]
+	if !ok {
+		return false, ErrTeamNotFound
+	}
+	return t.archivedAt != nil, nil
+}
+
+func (m *MemoryRepository) SetTeamArchived(ctx context.Context, teamName string, archived bool) error {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	t, ok := d.teams[teamName]
+	if !ok {
+		return ErrTeamNotFound
+	}
+	switch {
+	case !archived:
+		t.archivedAt = nil
+	case t.archivedAt == nil:
+		now := time.Now()
+		t.archivedAt = &now
+	}
+	return nil
+}
+
+func (m *MemoryRepository) DeleteTeam(ctx context.Context, teamName string) ([]string, error) {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	if _, ok := d.teams[teamName]; !ok {
+		return nil, ErrTeamNotFound
+	}
+
+	var detached []string
+	for _, u := range d.users {
+		if u.TeamName == teamName {
+			u.TeamName = ""
+			detached = append(detached, u.UserID)
+		}
+	}
+	delete(d.teams, teamName)
+	for _, t := range d.teams {
+		t.fallbacks = removeString(t.fallbacks, teamName)
+		if t.parent == teamName {
+			t.parent = ""
+		}
+	}
+	sort.Strings(detached)
+	return detached, nil
+}
+
+func (m *MemoryRepository) SetUserActive(ctx context.Context, userID string, active bool) (model.User, error) {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	u, ok := d.users[userID]
+	if !ok {
+		return model.User{}, ErrUserNotFound
+	}
+	u.IsActive = active
+	return *u, nil
+}
+
+func (m *MemoryRepository) SetUserTeam(ctx context.Context, userID, teamName string) (model.User, error) {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	if _, ok := d.teams[teamName]; teamName != "" && !ok {
+		return model.User{}, ErrTeamNotFound
+	}
+	u, ok := d.users[userID]
+	if !ok {
+		return model.User{}, ErrUserNotFound
+	}
+	u.TeamName = teamName
+	return *u, nil
+}
+
+func (m *MemoryRepository) SetUsername(ctx context.Context, userID, username string) (model.User, error) {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	u, ok := d.users[userID]
+	if !ok {
+		return model.User{}, ErrUserNotFound
+	}
+	u.Username = username
+	return *u, nil
+}
+
+func (m *MemoryRepository) SetUserTags(ctx context.Context, userID string, tags []string) (model.User, error) {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	u, ok := d.users[userID]
+	if !ok {
+		return model.User{}, ErrUserNotFound
+	}
+	u.Tags = sortedUnique(tags)
+	return *u, nil
+}
+
+func (m *MemoryRepository) SetUserCapacity(ctx context.Context, userID string, maxOpenReviews *int) (model.User, error) {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	u, ok := d.users[userID]
+	if !ok {
+		return model.User{}, ErrUserNotFound
+	}
+	u.MaxOpenReviews = copyInt(maxOpenReviews)
+	return *u, nil
+}
+
+func sortedUnique(list []string) []string {
+	if len(list) == 0 {
+		return nil
+	}
+	res := append([]string(nil), list...)
+	sort.Strings(res)
+	n := 1
+	for i := 1; i < len(res); i++ {
+		if res[i] != res[n-1] {
+			res[n] = res[i]
+			n++
+		}
+	}
+	return res[:n]
+}
+
+func removeString(list []string, s string) []string {
+	res := list[:0]
+	for _, v := range list {
+		if v != s {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func copyInt(v *int) *int {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	return &c
+}
+
+func (m *MemoryRepository) GetUser(ctx context.Context, userID string) (model.User, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	u, ok := d.users[userID]
+	if !ok {
+		return model.User{}, ErrUserNotFound
+	}
+	return *u, nil
+}
+
+func (m *MemoryRepository) GetActiveUsersByTeam(ctx context.Context, teamName string) ([]model.User, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	if _, ok := d.teams[teamName]; !ok {
+		return nil, ErrTeamNotFound
+	}
+
+	now := time.Now()
+	var users []model.User
+	for _, u := range d.users {
+		if u.TeamName == teamName && u.IsActive && !d.isAbsent(u.UserID, now) {
+			users = append(users, *u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+	return users, nil
+}
+
+func (d *memoryData) isAbsent(userID string, now time.Time) bool {
+	for _, a := range d.absences[userID] {
+		if !a.absence.StartsAt.After(now) && a.absence.EndsAt.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryRepository) SetAbsences(ctx context.Context, userID string, absences []model.Absence) error {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	if _, ok := d.users[userID]; !ok {
+		return ErrUserNotFound
+	}
+
+	list := make([]memAbsence, 0, len(absences))
+	for _, a := range absences {
+		d.absenceSeq++
+		a.ID = d.absenceSeq
+		a.UserID = userID
+		list = append(list, memAbsence{absence: a})
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].absence.StartsAt.Before(list[j].absence.StartsAt)
+	})
+	d.absences[userID] = list
+	return nil
+}
+
+func (m *MemoryRepository) GetAbsences(ctx context.Context, userID string) ([]model.Absence, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	if _, ok := d.users[userID]; !ok {
+		return nil, ErrUserNotFound
+	}
+
+	var res []model.Absence
+	for _, a := range d.absences[userID] {
+		res = append(res, a.absence)
+	}
+	return res, nil
+}
+
+func (m *MemoryRepository) GetUsersWithStartedAbsences(ctx context.Context) ([]string, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	now := time.Now()
+	var res []string
+	for userID, as := range d.absences {
+		for _, a := range as {
+			if a.started(now) {
+				res = append(res, userID)
+				break
+			}
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (m *MemoryRepository) ClaimStartedAbsences(ctx context.Context, userID string) ([]model.Absence, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	now := time.Now()
+	var res []model.Absence
+	for _, a := range d.absences[userID] {
+		if a.started(now) {
+			res = append(res, a.absence)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].StartsAt.Equal(res[j].StartsAt) {
+			return res[i].StartsAt.Before(res[j].StartsAt)
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res, nil
+}
+
+func (m *MemoryRepository) MarkAbsenceHandled(ctx context.Context, id int64) error {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	for _, as := range d.absences {
+		for i := range as {
+			if as[i].absence.ID == id {
+				as[i].reassigned = true
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+func (m *MemoryRepository) LockUsers(ctx context.Context, userIDs []string) ([]model.User, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	var users []model.User
+	for _, id := range userIDs {
+		if u, ok := d.users[id]; ok {
+			users = append(users, *u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+	return users, nil
+}
+
+func (m *MemoryRepository) CreatePRWithReviewers(ctx context.Context, pr model.PullRequest) error {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	if _, ok := d.prs[pr.ID]; ok {
+		return ErrPRExists
+	}
+
+	now := time.Now().UTC()
+	d.seq++
+	d.prs[pr.ID] = &memPR{
+		pr: model.PullRequest{
+			ID:           pr.ID,
+			Name:         pr.Name,
+			AuthorID:     pr.AuthorID,
+			Status:       pr.Status,
+			CreatedAt:    &now,
+			ChangedFiles: sortedUnique(pr.ChangedFiles),
+			RequiredTags: sortedUnique(pr.RequiredTags),
+		},
+		seq: d.seq,
+	}
+	for _, rv := range pr.Reviews {
+		d.prs[pr.ID].reviewers = append(d.prs[pr.ID].reviewers, model.Review{
+			ReviewerID: rv.ReviewerID,
+			State:      model.ReviewPending,
+			AssignedAt: &now,
+			SourceTeam: rv.SourceTeam,
+		})
+	}
+	return nil
+}
+
+func (d *memoryData) pullRequest(p *memPR) model.PullRequest {
+	pr := p.pr
+	reviews := append([]model.Review(nil), p.reviewers...)
+	sort.Slice(reviews, func(i, j int) bool { return reviews[i].ReviewerID < reviews[j].ReviewerID })
+	for i, rv := range reviews {
+		pr.AssignedReviewers = append(pr.AssignedReviewers, rv.ReviewerID)
+		reviews[i].AssignedAt = copyTime(rv.AssignedAt)
+		reviews[i].ReviewedAt = copyTime(rv.ReviewedAt)
+	}
+	if len(reviews) > 0 {
+		pr.Reviews = reviews
+	}
+	pr.CreatedAt = copyTime(p.pr.CreatedAt)
+	pr.MergedAt = copyTime(p.pr.MergedAt)
+	pr.ClosedAt = copyTime(p.pr.ClosedAt)
+	pr.ChangedFiles = append([]string(nil), p.pr.ChangedFiles...)
+	pr.RequiredTags = append([]string(nil), p.pr.RequiredTags...)
+	return pr
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+func (m *MemoryRepository) GetPR(ctx context.Context, prID string) (model.PullRequest, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	p, ok := d.prs[prID]
+	if !ok {
+		return model.PullRequest{}, ErrPRNotFound
+	}
+	return d.pullRequest(p), nil
+}
+
+// LockPR is GetPR; rows need no locking since InTx is exclusive.
+func (m *MemoryRepository) LockPR(ctx context.Context, prID string) (model.PullRequest, error) {
+	return m.GetPR(ctx, prID)
+}
+
+func (m *MemoryRepository) MarkPRMerged(ctx context.Context, prID, forcedBy string) (model.PullRequest, error) {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	p, ok := d.prs[prID]
+	if !ok {
+		return model.PullRequest{}, ErrPRNotFound
+	}
+	now := time.Now().UTC()
+	p.pr.Status = model.StatusMerged
+	if forcedBy != "" && !p.pr.ForceMerged {
+		p.pr.ForceMerged = true
+		p.pr.ForcedBy = forcedBy
+		p.pr.ForcedAt = &now
+	}
+	if p.pr.MergedAt == nil {
+		p.pr.MergedAt = &now
+	}
+	return d.pullRequest(p), nil
+}
+
+func (m *MemoryRepository) SetPRStatus(ctx context.Context, prID string, status model.PullRequestStatus) error {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	p, ok := d.prs[prID]
+	if !ok || p.pr.Status == model.StatusMerged {
+		return ErrPRNotFound
+	}
+	p.pr.Status = status
+	p.pr.ClosedAt = nil
+	if status == model.StatusClosed {
+		now := time.Now().UTC()
+		p.pr.ClosedAt = &now
+	}
+	return nil
+}
+
+func (m *MemoryRepository) AddReviewers(ctx context.Context, prID string, reviews []model.Review) error {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	p, ok := d.prs[prID]
+	if !ok {
+		return ErrPRNotFound
+	}
+	now := time.Now().UTC()
+	for _, rv := range reviews {
+		if p.hasReviewer(rv.ReviewerID) {
+			continue
+		}
+		p.reviewers = append(p.reviewers, model.Review{
+			ReviewerID: rv.ReviewerID,
+			State:      model.ReviewPending,
+			AssignedAt: &now,
+			SourceTeam: rv.SourceTeam,
+		})
+	}
+	return nil
+}
+
+func (m *MemoryRepository) ReassignReviewer(ctx context.Context, prID, oldReviewerID string, replacement model.Review) error {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	p, ok := d.prs[prID]
+	if ok {
+		for i, rv := range p.reviewers {
+			if rv.ReviewerID == oldReviewerID {
+				now := time.Now().UTC()
+				p.reviewers[i] = model.Review{
+					ReviewerID: replacement.ReviewerID,
+					State:      model.ReviewPending,
+					AssignedAt: &now,
+					SourceTeam: replacement.SourceTeam,
+				}
+				return nil
+			}
+		}
+	}
+	return errors.New("no reviewer row updated")
+}
+
+func (m *MemoryRepository) RemoveReviewer(ctx context.Context, prID, reviewerID string) error {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	p, ok := d.prs[prID]
+	if !ok {
+		return nil
+	}
+	for i, rv := range p.reviewers {
+		if rv.ReviewerID == reviewerID {
+			p.reviewers = append(p.reviewers[:i], p.reviewers[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *MemoryRepository) SetReviewState(ctx context.Context, prID, reviewerID string, state model.ReviewState) error {
+	d, unlock := m.lock(ctx)
+	defer unlock()
+
+	p, ok := d.prs[prID]
+	if !ok {
+		return ErrNotAssigned
+	}
+	i := p.reviewerIndex(reviewerID)
+	if i < 0 {
+		return ErrNotAssigned
+	}
+
+	rv := &p.reviewers[i]
+	decided := rv.State == model.ReviewApproved || rv.State == model.ReviewChangesRequested
+	if state != model.ReviewCommented || !decided {
+		rv.State = state
+	}
+	now := time.Now().UTC()
+	rv.ReviewedAt = &now
+	return nil
+}
+
+func (p *memPR) reviewerIndex(userID string) int {
+	for i, rv := range p.reviewers {
+		if rv.ReviewerID == userID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *memPR) hasReviewer(userID string) bool {
+	return p.reviewerIndex(userID) >= 0
+}
+
+func (m *MemoryRepository) GetPRsForReviewer(ctx context.Context, userID string) ([]model.PullRequestShort, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	var prs []*memPR
+	for _, p := range d.prs {
+		if p.hasReviewer(userID) {
+			prs = append(prs, p)
+		}
+	}
+	sort.Slice(prs, func(i, j int) bool { return prs[i].seq > prs[j].seq })
+
+	var res []model.PullRequestShort
+	for _, p := range prs {
+		res = append(res, model.PullRequestShort{
+			ID:       p.pr.ID,
+			Name:     p.pr.Name,
+			AuthorID: p.pr.AuthorID,
+			Status:   p.pr.Status,
+		})
+	}
+	return res, nil
+}
+
+func (m *MemoryRepository) GetPRsByTeam(ctx context.Context, teamName string) ([]model.PullRequestShort, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	var prs []*memPR
+	for _, p := range d.prs {
+		if u, ok := d.users[p.pr.AuthorID]; ok && u.TeamName == teamName {
+			prs = append(prs, p)
+		}
+	}
+	sort.Slice(prs, func(i, j int) bool { return prs[i].seq > prs[j].seq })
+
+	var res []model.PullRequestShort
+	for _, p := range prs {
+		res = append(res, model.PullRequestShort{
+			ID:       p.pr.ID,
+			Name:     p.pr.Name,
+			AuthorID: p.pr.AuthorID,
+			Status:   p.pr.Status,
+		})
+	}
+	return res, nil
+}
+
+func (m *MemoryRepository) GetOpenReviewCounts(ctx context.Context, userIDs []string) (map[string]int, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	wanted := make(map[string]struct{}, len(userIDs))
+	for _, id := range userIDs {
+		wanted[id] = struct{}{}
+	}
+
+	res := make(map[string]int, len(userIDs))
+	for _, p := range d.prs {
+		if p.pr.Status != model.StatusOpen {
+			continue
+		}
+		for _, rv := range p.reviewers {
+			if _, ok := wanted[rv.ReviewerID]; ok {
+				res[rv.ReviewerID]++
+			}
+		}
+	}
+	return res, nil
+}
+
+func (m *MemoryRepository) GetPRTimes(ctx context.Context, teamName string, since time.Time) ([]model.PRTimes, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	var (
+		res  []model.PRTimes
+		seqs = make(map[string]int64)
+	)
+	for _, p := range d.prs {
+		author := ""
+		if u, ok := d.users[p.pr.AuthorID]; ok {
+			author = u.TeamName
+		}
+		if teamName != "" && author != teamName {
+			continue
+		}
+		merged := p.pr.MergedAt != nil && !p.pr.MergedAt.Before(since)
+		if p.pr.CreatedAt.Before(since) && !merged && p.pr.Status != model.StatusOpen {
+			continue
+		}
+		res = append(res, model.PRTimes{
+			ID:        p.pr.ID,
+			AuthorID:  p.pr.AuthorID,
+			TeamName:  author,
+			Status:    p.pr.Status,
+			CreatedAt: *p.pr.CreatedAt,
+			MergedAt:  copyTime(p.pr.MergedAt),
+		})
+		seqs[p.pr.ID] = p.seq
+	}
+	sort.Slice(res, func(i, j int) bool { return seqs[res[i].ID] < seqs[res[j].ID] })
+	return res, nil
+}
+
+func (m *MemoryRepository) GetPairCounts(ctx context.Context, authorID string, reviewerIDs []string, since time.Time) (map[string]int, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	wanted := make(map[string]struct{}, len(reviewerIDs))
+	for _, id := range reviewerIDs {
+		wanted[id] = struct{}{}
+	}
+
+	res := make(map[string]int, len(reviewerIDs))
+	for _, p := range d.prs {
+		if p.pr.AuthorID != authorID {
+			continue
+		}
+		for _, rv := range p.reviewers {
+			if _, ok := wanted[rv.ReviewerID]; ok && !rv.AssignedAt.Before(since) {
+				res[rv.ReviewerID]++
+			}
+		}
+	}
+	return res, nil
+}
+
+func (m *MemoryRepository) GetTeamPairings(ctx context.Context, teamName string, since *time.Time) ([]model.PairCount, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	counts := make(map[[2]string]int)
+	for _, p := range d.prs {
+		if a, ok := d.users[p.pr.AuthorID]; !ok || a.TeamName != teamName {
+			continue
+		}
+		for _, rv := range p.reviewers {
+			if since == nil || !rv.AssignedAt.Before(*since) {
+				counts[[2]string{p.pr.AuthorID, rv.ReviewerID}]++
+			}
+		}
+	}
+
+	res := make([]model.PairCount, 0, len(counts))
+	for k, n := range counts {
+		res = append(res, model.PairCount{AuthorID: k[0], ReviewerID: k[1], Count: n})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].AuthorID != res[j].AuthorID {
+			return res[i].AuthorID < res[j].AuthorID
+		}
+		return res[i].ReviewerID < res[j].ReviewerID
+	})
+	return res, nil
+}
+
+func (m *MemoryRepository) GetReviewerStats(ctx context.Context, f model.ReviewerStatsFilter) ([]model.ReviewerStatsItem, error) {
+	d, unlock := m.rlock(ctx)
+	defer unlock()
+
+	items := make(map[string]*model.ReviewerStatsItem)
+	for _, u := range d.users {
+		if f.TeamName == "" || u.TeamName == f.TeamName {
+			items[u.UserID] = &model.ReviewerStatsItem{UserID: u.UserID, TeamName: u.TeamName, IsActive: u.IsActive}
+		}
+	}
+
+	for _, p := range d.prs {
+		if f.Status != "" && p.pr.Status != f.Status {
+			continue
+		}
+		for _, rv := range p.reviewers {
+			item, ok := items[rv.ReviewerID]
+			if !ok ||
+				f.From != nil && rv.AssignedAt.Before(*f.From) ||
+				f.To != nil && !rv.AssignedAt.Before(*f.To) {
+				continue
+			}
+			item.ReviewCount++
+			switch p.pr.Status {
+			case model.StatusOpen:
+				item.OpenCount++
+			case model.StatusMerged, model.StatusClosed:
+				item.CompletedCount++
+			}
+		}
+	}
+
+	res := make([]model.ReviewerStatsItem, 0, len(items))
+	for _, item := range items {
+		res = append(res, *item)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].ReviewCount != res[j].ReviewCount {
+			return res[i].ReviewCount > res[j].ReviewCount
+		}
+		return res[i].UserID < res[j].UserID
+	})
+	return res, nil
+}
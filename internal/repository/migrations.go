@@ -0,0 +1,442 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migrationLockKey is the pg_advisory_lock key held while migrations run,
+// so that several replicas starting at once apply them one by one.
+const migrationLockKey int64 = 0x50525f7265766965
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// migrations must be ordered by version. Never edit an applied migration,
+// add a new one instead.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "init",
+		up: `
+CREATE TABLE IF NOT EXISTS teams (
+    name TEXT PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT PRIMARY KEY,
+    username TEXT NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    team_name TEXT NOT NULL REFERENCES teams(name)
+);
+
+CREATE TABLE IF NOT EXISTS pull_requests (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    author_id TEXT NOT NULL REFERENCES users(id),
+    status TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    merged_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS pull_request_reviewers (
+    pull_request_id TEXT NOT NULL REFERENCES pull_requests(id) ON DELETE CASCADE,
+    reviewer_id TEXT NOT NULL REFERENCES users(id),
+    PRIMARY KEY (pull_request_id, reviewer_id)
+);
+`,
+		down: `
+DROP TABLE IF EXISTS pull_request_reviewers;
+DROP TABLE IF EXISTS pull_requests;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS teams;
+`,
+	},
+	{
+		version: 2,
+		name:    "team_reviewer_count",
+		up: `
+ALTER TABLE teams ADD COLUMN IF NOT EXISTS reviewer_count INT NOT NULL DEFAULT 2;
+`,
+		down: `
+ALTER TABLE teams DROP COLUMN IF EXISTS reviewer_count;
+`,
+	},
+	{
+		version: 3,
+		name:    "review_states",
+		up: `
+ALTER TABLE pull_request_reviewers
+    ADD COLUMN state TEXT NOT NULL DEFAULT 'PENDING',
+    ADD COLUMN assigned_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN reviewed_at TIMESTAMPTZ;
+
+UPDATE pull_request_reviewers r
+SET assigned_at = p.created_at
+FROM pull_requests p
+WHERE p.id = r.pull_request_id;
+`,
+		down: `
+ALTER TABLE pull_request_reviewers
+    DROP COLUMN state,
+    DROP COLUMN assigned_at,
+    DROP COLUMN reviewed_at;
+`,
+	},
+	{
+		version: 4,
+		name:    "merge_approvals",
+		up: `
+ALTER TABLE teams ADD COLUMN required_approvals INT NOT NULL DEFAULT 0;
+ALTER TABLE pull_requests ADD COLUMN force_merged BOOLEAN NOT NULL DEFAULT FALSE;
+`,
+		down: `
+ALTER TABLE pull_requests DROP COLUMN force_merged;
+ALTER TABLE teams DROP COLUMN required_approvals;
+`,
+	},
+	{
+		version: 5,
+		name:    "pr_closed_at",
+		up: `
+ALTER TABLE pull_requests ADD COLUMN closed_at TIMESTAMPTZ;
+`,
+		down: `
+UPDATE pull_requests SET status = 'OPEN' WHERE status IN ('CLOSED', 'DRAFT');
+ALTER TABLE pull_requests DROP COLUMN closed_at;
+`,
+	},
+	{
+		version: 6,
+		name:    "user_absences",
+		up: `
+CREATE TABLE user_absences (
+    id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    reassigned_at TIMESTAMPTZ,
+    CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX user_absences_user_id_idx ON user_absences (user_id, starts_at);
+`,
+		down: `
+DROP TABLE user_absences;
+`,
+	},
+	{
+		version: 7,
+		name:    "user_capacity",
+		up: `
+ALTER TABLE users ADD COLUMN max_open_reviews INT CHECK (max_open_reviews >= 0);
+`,
+		down: `
+ALTER TABLE users DROP COLUMN max_open_reviews;
+`,
+	},
+	{
+		version: 8,
+		name:    "users_without_team",
+		up: `
+ALTER TABLE users ALTER COLUMN team_name DROP NOT NULL;
+`,
+		// Refuses instead of deleting or re-homing users: team-less users
+		// must be put into a team by hand before reverting.
+		down: `
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM users WHERE team_name IS NULL) THEN
+        RAISE EXCEPTION 'cannot revert users_without_team: some users have no team';
+    END IF;
+END $$;
+ALTER TABLE users ALTER COLUMN team_name SET NOT NULL;
+`,
+	},
+	{
+		version: 9,
+		name:    "team_archive",
+		up: `
+ALTER TABLE teams ADD COLUMN archived_at TIMESTAMPTZ;
+`,
+		down: `
+ALTER TABLE teams DROP COLUMN archived_at;
+`,
+	},
+	{
+		version: 10,
+		name:    "team_fallbacks",
+		up: `
+CREATE TABLE team_fallbacks (
+    team_name TEXT NOT NULL REFERENCES teams(name) ON DELETE CASCADE,
+    fallback_team TEXT NOT NULL REFERENCES teams(name) ON DELETE CASCADE,
+    position INT NOT NULL,
+    PRIMARY KEY (team_name, fallback_team),
+    CHECK (team_name <> fallback_team)
+);
+
+ALTER TABLE pull_request_reviewers ADD COLUMN source_team TEXT;
+
+UPDATE pull_request_reviewers r
+SET source_team = u.team_name
+FROM users u
+WHERE u.id = r.reviewer_id;
+`,
+		down: `
+ALTER TABLE pull_request_reviewers DROP COLUMN source_team;
+DROP TABLE team_fallbacks;
+`,
+	},
+	{
+		version: 11,
+		name:    "team_hierarchy",
+		up: `
+ALTER TABLE teams
+    ADD COLUMN parent_team TEXT REFERENCES teams(name) ON DELETE SET NULL,
+    ADD COLUMN climb_hierarchy BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD CHECK (parent_team <> name);
+
+CREATE INDEX teams_parent_team_idx ON teams (parent_team);
+`,
+		down: `
+ALTER TABLE teams
+    DROP COLUMN parent_team,
+    DROP COLUMN climb_hierarchy;
+`,
+	},
+	{
+		version: 12,
+		name:    "code_owners",
+		up: `
+CREATE TABLE team_code_owners (
+    team_name TEXT PRIMARY KEY REFERENCES teams(name) ON DELETE CASCADE,
+    rules TEXT NOT NULL,
+    mode TEXT NOT NULL DEFAULT 'prefer'
+);
+
+CREATE TABLE pull_request_files (
+    pull_request_id TEXT NOT NULL REFERENCES pull_requests(id) ON DELETE CASCADE,
+    path TEXT NOT NULL,
+    PRIMARY KEY (pull_request_id, path)
+);
+`,
+		down: `
+DROP TABLE pull_request_files;
+DROP TABLE team_code_owners;
+`,
+	},
+	{
+		version: 13,
+		name:    "skill_tags",
+		up: `
+ALTER TABLE users ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE pull_requests ADD COLUMN required_tags TEXT[] NOT NULL DEFAULT '{}';
+`,
+		down: `
+ALTER TABLE pull_requests DROP COLUMN required_tags;
+ALTER TABLE users DROP COLUMN tags;
+`,
+	},
+	{
+		version: 14,
+		name:    "force_merge_audit",
+		up: `
+ALTER TABLE pull_requests
+    ADD COLUMN forced_by TEXT REFERENCES users(id),
+    ADD COLUMN forced_at TIMESTAMPTZ;
+
+UPDATE pull_requests SET forced_at = merged_at WHERE force_merged;
+`,
+		down: `
+ALTER TABLE pull_requests
+    DROP COLUMN forced_by,
+    DROP COLUMN forced_at;
+`,
+	},
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// LatestMigrationVersion returns the version of the newest known migration.
+func LatestMigrationVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].version
+}
+
+// Migrate applies all pending migrations.
+func (r *Repository) Migrate(ctx context.Context) error {
+	return r.MigrateTo(ctx, LatestMigrationVersion())
+}
+
+// MigrateDown reverts the given number of most recently applied migrations.
+func (r *Repository) MigrateDown(ctx context.Context, steps int) error {
+	return r.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.version]; !ok {
+				continue
+			}
+			if err := revertMigration(ctx, conn, m); err != nil {
+				return err
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// MigrateTo applies or reverts migrations until the schema is at version.
+// Version 0 reverts everything.
+func (r *Repository) MigrateTo(ctx context.Context, version int) error {
+	if version < 0 || version > LatestMigrationVersion() {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	return r.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.version]; !ok || m.version <= version {
+				continue
+			}
+			if err := revertMigration(ctx, conn, m); err != nil {
+				return err
+			}
+		}
+
+		for _, m := range migrations {
+			if _, ok := applied[m.version]; ok || m.version > version {
+				continue
+			}
+			if err := applyMigration(ctx, conn, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MigrationStatus lists all known migrations and when they were applied.
+func (r *Repository) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	var res []MigrationStatus
+	err := r.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			st := MigrationStatus{Version: m.version, Name: m.name}
+			if at, ok := applied[m.version]; ok {
+				st.AppliedAt = &at
+			}
+			res = append(res, st)
+		}
+		return nil
+	})
+	return res, err
+}
+
+func (r *Repository) withMigrationLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+	}()
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+		    version INT PRIMARY KEY,
+		    name TEXT NOT NULL,
+		    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		res[version] = appliedAt
+	}
+	return res, rows.Err()
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, m migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.up); err != nil {
+		return fmt.Errorf("migration %d_%s up: %w", m.version, m.name, err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.version, m.name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func revertMigration(ctx context.Context, conn *sql.Conn, m migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.down); err != nil {
+		return fmt.Errorf("migration %d_%s down: %w", m.version, m.name, err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM schema_migrations WHERE version = $1", m.version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -4,8 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"sort"
 	"time"
 
+	"github.com/lib/pq"
+
 	"github.com/Mavichy/AvitoNovember/internal/model"
 )
 
@@ -15,6 +19,10 @@ var (
 	ErrTeamNotFound = errors.New("team not found")
 	ErrPRExists     = errors.New("pull request already exists")
 	ErrPRNotFound   = errors.New("pull request not found")
+	ErrNotAssigned  = errors.New("reviewer is not assigned to pull request")
+	// ErrUserInOtherTeam is returned when adding a user that is a member of
+	// another team; such users have to be moved explicitly.
+	ErrUserInOtherTeam = errors.New("user belongs to another team")
 )
 
 type Repository struct {
@@ -25,49 +33,58 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
-const schemaSQL = `
-CREATE TABLE IF NOT EXISTS teams (
-    name TEXT PRIMARY KEY
-);
-
-CREATE TABLE IF NOT EXISTS users (
-    id TEXT PRIMARY KEY,
-    username TEXT NOT NULL,
-    is_active BOOLEAN NOT NULL DEFAULT TRUE,
-    team_name TEXT NOT NULL REFERENCES teams(name)
-);
-
-CREATE TABLE IF NOT EXISTS pull_requests (
-    id TEXT PRIMARY KEY,
-    name TEXT NOT NULL,
-    author_id TEXT NOT NULL REFERENCES users(id),
-    status TEXT NOT NULL,
-    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
-    merged_at TIMESTAMPTZ
-);
-
-CREATE TABLE IF NOT EXISTS pull_request_reviewers (
-    pull_request_id TEXT NOT NULL REFERENCES pull_requests(id) ON DELETE CASCADE,
-    reviewer_id TEXT NOT NULL REFERENCES users(id),
-    PRIMARY KEY (pull_request_id, reviewer_id)
-);
-`
-
-func (r *Repository) Migrate(ctx context.Context) error {
-	_, err := r.db.ExecContext(ctx, schemaSQL)
-	return err
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 }
 
-func (r *Repository) CreateTeam(ctx context.Context, teamName string, members []model.TeamMember) error {
+type txKey struct{}
+
+// InTx runs fn in a database transaction carried by the context passed to fn.
+// Repository calls made with that context take part in the transaction.
+// A nested InTx joins the outer transaction.
+func (r *Repository) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) q(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return r.db
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func (r *Repository) CreateTeam(ctx context.Context, team model.Team) error {
+	return r.InTx(ctx, func(ctx context.Context) error {
+		return r.createTeam(ctx, team)
+	})
+}
+
+func (r *Repository) createTeam(ctx context.Context, team model.Team) error {
+	tx := r.q(ctx)
+
 	var exists bool
 	if err := tx.QueryRowContext(ctx,
-		"SELECT EXISTS(SELECT 1 FROM teams WHERE name=$1)", teamName).
+		"SELECT EXISTS(SELECT 1 FROM teams WHERE name=$1)", team.TeamName).
 		Scan(&exists); err != nil {
 		return err
 	}
@@ -75,41 +92,120 @@ func (r *Repository) CreateTeam(ctx context.Context, teamName string, members []
 		return ErrTeamExists
 	}
 
-	if _, err := tx.ExecContext(ctx,
-		"INSERT INTO teams (name) VALUES ($1)", teamName); err != nil {
+	if team.ParentTeam != "" {
+		if _, err := r.GetTeamSettings(ctx, team.ParentTeam); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO teams (name, reviewer_count, required_approvals, climb_hierarchy, parent_team)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+	`, team.TeamName, team.ReviewerCount, team.RequiredApprovals, team.ClimbHierarchy, team.ParentTeam); err != nil {
+		if isUniqueViolation(err) {
+			return ErrTeamExists
+		}
+		return err
+	}
+
+	if err := r.setTeamFallbacks(ctx, team.TeamName, team.FallbackTeams); err != nil {
 		return err
 	}
+	return r.upsertMembers(ctx, team.TeamName, team.Members)
+}
 
+// AddTeamMembers adds users to an existing team. Members already in the
+// team get their username and is_active updated.
+func (r *Repository) AddTeamMembers(ctx context.Context, teamName string, members []model.TeamMember) error {
+	return r.InTx(ctx, func(ctx context.Context) error {
+		if _, err := r.GetTeamSettings(ctx, teamName); err != nil {
+			return err
+		}
+		return r.upsertMembers(ctx, teamName, members)
+	})
+}
+
+// upsertMembers inserts the members into teamName or updates them if they
+// are already there or have no team. A member of another team fails with
+// ErrUserInOtherTeam instead of being moved silently.
+func (r *Repository) upsertMembers(ctx context.Context, teamName string, members []model.TeamMember) error {
 	for _, m := range members {
-		_, err := tx.ExecContext(ctx, `
-			INSERT INTO users (id, username, is_active, team_name)
-			VALUES ($1, $2, $3, $4)
+		res, err := r.q(ctx).ExecContext(ctx, `
+			INSERT INTO users (id, username, is_active, team_name, tags)
+			VALUES ($1, $2, $3, $4, COALESCE($5::text[], '{}'))
 			ON CONFLICT (id) DO UPDATE
 			SET username = EXCLUDED.username,
 			    is_active = EXCLUDED.is_active,
-			    team_name = EXCLUDED.team_name
-		`, m.UserID, m.Username, m.IsActive, teamName)
+			    team_name = EXCLUDED.team_name,
+			    tags = COALESCE($5::text[], users.tags)
+			WHERE users.team_name IS NULL OR users.team_name = EXCLUDED.team_name
+		`, m.UserID, m.Username, m.IsActive, teamName, pq.Array(m.Tags))
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
 		if err != nil {
 			return err
 		}
+		if affected == 0 {
+			return fmt.Errorf("user %s: %w", m.UserID, ErrUserInOtherTeam)
+		}
 	}
+	return nil
+}
 
-	return tx.Commit()
+func (r *Repository) GetTeamSettings(ctx context.Context, teamName string) (model.TeamSettings, error) {
+	var ts model.TeamSettings
+	if err := r.q(ctx).QueryRowContext(ctx,
+		"SELECT reviewer_count, required_approvals, climb_hierarchy FROM teams WHERE name=$1", teamName).
+		Scan(&ts.ReviewerCount, &ts.RequiredApprovals, &ts.ClimbHierarchy); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.TeamSettings{}, ErrTeamNotFound
+		}
+		return model.TeamSettings{}, err
+	}
+	return ts, nil
+}
+
+func (r *Repository) SetTeamSettings(ctx context.Context, teamName string, ts model.TeamSettings) error {
+	res, err := r.q(ctx).ExecContext(ctx, `
+		UPDATE teams
+		SET reviewer_count = $2,
+		    required_approvals = $3,
+		    climb_hierarchy = $4
+		WHERE name = $1
+	`, teamName, ts.ReviewerCount, ts.RequiredApprovals, ts.ClimbHierarchy)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTeamNotFound
+	}
+	return nil
 }
 
 func (r *Repository) GetTeam(ctx context.Context, teamName string) (model.Team, error) {
-	var exists bool
-	if err := r.db.QueryRowContext(ctx,
-		"SELECT EXISTS(SELECT 1 FROM teams WHERE name=$1)", teamName).
-		Scan(&exists); err != nil {
+	settings, err := r.GetTeamSettings(ctx, teamName)
+	if err != nil {
 		return model.Team{}, err
 	}
-	if !exists {
-		return model.Team{}, ErrTeamNotFound
+
+	var (
+		archivedAt sql.NullTime
+		parent     sql.NullString
+	)
+	if err := r.q(ctx).QueryRowContext(ctx,
+		"SELECT archived_at, parent_team FROM teams WHERE name=$1", teamName).
+		Scan(&archivedAt, &parent); err != nil {
+		return model.Team{}, err
 	}
 
-	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, username, is_active
+	rows, err := r.q(ctx).QueryContext(ctx, `
+		SELECT id, username, is_active, tags
 		FROM users
 		WHERE team_name = $1
 		ORDER BY id
@@ -122,28 +218,383 @@ func (r *Repository) GetTeam(ctx context.Context, teamName string) (model.Team,
 	var members []model.TeamMember
 	for rows.Next() {
 		var m model.TeamMember
-		if err := rows.Scan(&m.UserID, &m.Username, &m.IsActive); err != nil {
+		if err := rows.Scan(&m.UserID, &m.Username, &m.IsActive, pq.Array(&m.Tags)); err != nil {
 			return model.Team{}, err
 		}
 		members = append(members, m)
 	}
 
-	return model.Team{
-		TeamName: teamName,
-		Members:  members,
-	}, nil
+	fallbacks, err := r.GetTeamFallbacks(ctx, teamName)
+	if err != nil {
+		return model.Team{}, err
+	}
+
+	team := model.Team{
+		TeamName:      teamName,
+		ParentTeam:    parent.String,
+		TeamSettings:  settings,
+		FallbackTeams: fallbacks,
+		Members:       members,
+	}
+	if archivedAt.Valid {
+		team.ArchivedAt = &archivedAt.Time
+	}
+	return team, nil
+}
+
+func (r *Repository) GetTeamFallbacks(ctx context.Context, teamName string) ([]string, error) {
+	rows, err := r.q(ctx).QueryContext(ctx, `
+		SELECT fallback_team
+		FROM team_fallbacks
+		WHERE team_name = $1
+		ORDER BY position
+	`, teamName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		res = append(res, name)
+	}
+	return res, rows.Err()
+}
+
+// SetTeamFallbacks replaces the team's ordered list of fallback teams.
+func (r *Repository) SetTeamFallbacks(ctx context.Context, teamName string, fallbacks []string) error {
+	return r.InTx(ctx, func(ctx context.Context) error {
+		if _, err := r.GetTeamSettings(ctx, teamName); err != nil {
+			return err
+		}
+		if _, err := r.q(ctx).ExecContext(ctx,
+			"DELETE FROM team_fallbacks WHERE team_name = $1", teamName); err != nil {
+			return err
+		}
+		return r.setTeamFallbacks(ctx, teamName, fallbacks)
+	})
+}
+
+func (r *Repository) setTeamFallbacks(ctx context.Context, teamName string, fallbacks []string) error {
+	for i, fb := range fallbacks {
+		if _, err := r.GetTeamSettings(ctx, fb); err != nil {
+			return err
+		}
+		if _, err := r.q(ctx).ExecContext(ctx, `
+			INSERT INTO team_fallbacks (team_name, fallback_team, position)
+			VALUES ($1, $2, $3)
+		`, teamName, fb, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTeamParent returns the parent of the team, "" for a top-level team.
+func (r *Repository) GetTeamParent(ctx context.Context, teamName string) (string, error) {
+	var parent sql.NullString
+	if err := r.q(ctx).QueryRowContext(ctx,
+		"SELECT parent_team FROM teams WHERE name=$1", teamName).
+		Scan(&parent); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrTeamNotFound
+		}
+		return "", err
+	}
+	return parent.String, nil
+}
+
+// SetTeamParent sets the parent of the team; "" makes it a top-level team.
+// It does not check for cycles.
+func (r *Repository) SetTeamParent(ctx context.Context, teamName, parent string) error {
+	if parent != "" {
+		if _, err := r.GetTeamSettings(ctx, parent); err != nil {
+			return err
+		}
+	}
+
+	res, err := r.q(ctx).ExecContext(ctx,
+		"UPDATE teams SET parent_team = NULLIF($2, '') WHERE name = $1", teamName, parent)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTeamNotFound
+	}
+	return nil
+}
+
+// GetSubteams returns the names of the direct subteams of parent, or of the
+// top-level teams if parent is "".
+func (r *Repository) GetSubteams(ctx context.Context, parent string) ([]string, error) {
+	rows, err := r.q(ctx).QueryContext(ctx, `
+		SELECT name
+		FROM teams
+		WHERE parent_team IS NOT DISTINCT FROM NULLIF($1, '')
+		ORDER BY name
+	`, parent)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		res = append(res, name)
+	}
+	return res, rows.Err()
+}
+
+// GetCodeOwners returns the team's ownership rules; a team without rules
+// gets empty rules in prefer mode.
+func (r *Repository) GetCodeOwners(ctx context.Context, teamName string) (model.CodeOwners, error) {
+	if _, err := r.GetTeamSettings(ctx, teamName); err != nil {
+		return model.CodeOwners{}, err
+	}
+
+	co := model.CodeOwners{Mode: model.CodeOwnersPrefer}
+	var mode string
+	err := r.q(ctx).QueryRowContext(ctx,
+		"SELECT rules, mode FROM team_code_owners WHERE team_name = $1", teamName).
+		Scan(&co.Rules, &mode)
+	if errors.Is(err, sql.ErrNoRows) {
+		return co, nil
+	}
+	if err != nil {
+		return model.CodeOwners{}, err
+	}
+	co.Mode = model.CodeOwnersMode(mode)
+	return co, nil
+}
+
+func (r *Repository) SetCodeOwners(ctx context.Context, teamName string, co model.CodeOwners) error {
+	if _, err := r.GetTeamSettings(ctx, teamName); err != nil {
+		return err
+	}
+
+	_, err := r.q(ctx).ExecContext(ctx, `
+		INSERT INTO team_code_owners (team_name, rules, mode)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (team_name) DO UPDATE
+		SET rules = EXCLUDED.rules,
+		    mode = EXCLUDED.mode
+	`, teamName, co.Rules, string(co.Mode))
+	return err
+}
+
+func (r *Repository) IsTeamArchived(ctx context.Context, teamName string) (bool, error) {
+	var archived bool
+	if err := r.q(ctx).QueryRowContext(ctx,
+		"SELECT archived_at IS NOT NULL FROM teams WHERE name=$1", teamName).
+		Scan(&archived); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrTeamNotFound
+		}
+		return false, err
+	}
+	return archived, nil
+}
+
+// SetTeamArchived archives or restores the team. Archiving an archived team
+// keeps the original archived_at.
+func (r *Repository) SetTeamArchived(ctx context.Context, teamName string, archived bool) error {
+	res, err := r.q(ctx).ExecContext(ctx, `
+		UPDATE teams
+		SET archived_at = CASE WHEN $2 THEN COALESCE(archived_at, now()) END
+		WHERE name = $1
+	`, teamName, archived)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTeamNotFound
+	}
+	return nil
+}
+
+// DeleteTeam deletes the team. Its members stay without a team, so their
+// pull requests and reviews are kept. Returns the ids of those members.
+func (r *Repository) DeleteTeam(ctx context.Context, teamName string) ([]string, error) {
+	var detached []string
+	err := r.InTx(ctx, func(ctx context.Context) error {
+		rows, err := r.q(ctx).QueryContext(ctx, `
+			UPDATE users
+			SET team_name = NULL
+			WHERE team_name = $1
+			RETURNING id
+		`, teamName)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			detached = append(detached, id)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		res, err := r.q(ctx).ExecContext(ctx, "DELETE FROM teams WHERE name = $1", teamName)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ErrTeamNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(detached)
+	return detached, nil
+}
+
+const userColumns = "id, username, team_name, is_active, max_open_reviews, tags"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row rowScanner) (model.User, error) {
+	var (
+		u        model.User
+		teamName sql.NullString
+		capacity sql.NullInt64
+	)
+	if err := row.Scan(&u.UserID, &u.Username, &teamName, &u.IsActive, &capacity, pq.Array(&u.Tags)); err != nil {
+		return model.User{}, err
+	}
+	u.TeamName = teamName.String
+	if capacity.Valid {
+		v := int(capacity.Int64)
+		u.MaxOpenReviews = &v
+	}
+	return u, nil
+}
+
+// SetUserTags replaces the user's tags.
+func (r *Repository) SetUserTags(ctx context.Context, userID string, tags []string) (model.User, error) {
+	row := r.q(ctx).QueryRowContext(ctx, `
+		UPDATE users
+		SET tags = $2
+		WHERE id = $1
+		RETURNING `+userColumns+`
+	`, userID, pq.Array(append([]string{}, tags...)))
+
+	u, err := scanUser(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.User{}, ErrUserNotFound
+		}
+		return model.User{}, err
+	}
+	return u, nil
+}
+
+// SetUserCapacity sets the user's limit of open reviews; nil removes it.
+func (r *Repository) SetUserCapacity(ctx context.Context, userID string, maxOpenReviews *int) (model.User, error) {
+	var capacity sql.NullInt64
+	if maxOpenReviews != nil {
+		capacity = sql.NullInt64{Int64: int64(*maxOpenReviews), Valid: true}
+	}
+
+	row := r.q(ctx).QueryRowContext(ctx, `
+		UPDATE users
+		SET max_open_reviews = $2
+		WHERE id = $1
+		RETURNING `+userColumns+`
+	`, userID, capacity)
+
+	u, err := scanUser(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.User{}, ErrUserNotFound
+		}
+		return model.User{}, err
+	}
+	return u, nil
+}
+
+// SetUserTeam moves the user to teamName; an empty teamName removes the
+// user from their team.
+func (r *Repository) SetUserTeam(ctx context.Context, userID, teamName string) (model.User, error) {
+	if teamName != "" {
+		if _, err := r.GetTeamSettings(ctx, teamName); err != nil {
+			return model.User{}, err
+		}
+	}
+
+	row := r.q(ctx).QueryRowContext(ctx, `
+		UPDATE users
+		SET team_name = NULLIF($2, '')
+		WHERE id = $1
+		RETURNING `+userColumns+`
+	`, userID, teamName)
+
+	u, err := scanUser(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.User{}, ErrUserNotFound
+		}
+		return model.User{}, err
+	}
+	return u, nil
+}
+
+func (r *Repository) SetUsername(ctx context.Context, userID, username string) (model.User, error) {
+	row := r.q(ctx).QueryRowContext(ctx, `
+		UPDATE users
+		SET username = $2
+		WHERE id = $1
+		RETURNING `+userColumns+`
+	`, userID, username)
+
+	u, err := scanUser(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.User{}, ErrUserNotFound
+		}
+		return model.User{}, err
+	}
+	return u, nil
 }
 
 func (r *Repository) SetUserActive(ctx context.Context, userID string, active bool) (model.User, error) {
-	row := r.db.QueryRowContext(ctx, `
+	row := r.q(ctx).QueryRowContext(ctx, `
 		UPDATE users
 		SET is_active = $2
 		WHERE id = $1
-		RETURNING id, username, team_name, is_active
+		RETURNING `+userColumns+`
 	`, userID, active)
 
-	var u model.User
-	if err := row.Scan(&u.UserID, &u.Username, &u.TeamName, &u.IsActive); err != nil {
+	u, err := scanUser(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return model.User{}, ErrUserNotFound
 		}
@@ -153,14 +604,14 @@ func (r *Repository) SetUserActive(ctx context.Context, userID string, active bo
 }
 
 func (r *Repository) GetUser(ctx context.Context, userID string) (model.User, error) {
-	row := r.db.QueryRowContext(ctx, `
-		SELECT id, username, team_name, is_active
+	row := r.q(ctx).QueryRowContext(ctx, `
+		SELECT `+userColumns+`
 		FROM users
 		WHERE id = $1
 	`, userID)
 
-	var u model.User
-	if err := row.Scan(&u.UserID, &u.Username, &u.TeamName, &u.IsActive); err != nil {
+	u, err := scanUser(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return model.User{}, ErrUserNotFound
 		}
@@ -171,7 +622,7 @@ func (r *Repository) GetUser(ctx context.Context, userID string) (model.User, er
 
 func (r *Repository) GetActiveUsersByTeam(ctx context.Context, teamName string) ([]model.User, error) {
 	var exists bool
-	if err := r.db.QueryRowContext(ctx,
+	if err := r.q(ctx).QueryRowContext(ctx,
 		"SELECT EXISTS(SELECT 1 FROM teams WHERE name=$1)", teamName).
 		Scan(&exists); err != nil {
 		return nil, err
@@ -180,10 +631,15 @@ func (r *Repository) GetActiveUsersByTeam(ctx context.Context, teamName string)
 		return nil, ErrTeamNotFound
 	}
 
-	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, username, team_name, is_active
-		FROM users
+	rows, err := r.q(ctx).QueryContext(ctx, `
+		SELECT `+userColumns+`
+		FROM users u
 		WHERE team_name = $1 AND is_active = TRUE
+		  AND NOT EXISTS (
+		      SELECT 1 FROM user_absences a
+		      WHERE a.user_id = u.id AND a.starts_at <= now() AND a.ends_at > now()
+		  )
+		ORDER BY id
 	`, teamName)
 	if err != nil {
 		return nil, err
@@ -192,8 +648,8 @@ func (r *Repository) GetActiveUsersByTeam(ctx context.Context, teamName string)
 
 	var users []model.User
 	for rows.Next() {
-		var u model.User
-		if err := rows.Scan(&u.UserID, &u.Username, &u.TeamName, &u.IsActive); err != nil {
+		u, err := scanUser(rows)
+		if err != nil {
 			return nil, err
 		}
 		users = append(users, u)
@@ -201,12 +657,40 @@ func (r *Repository) GetActiveUsersByTeam(ctx context.Context, teamName string)
 	return users, nil
 }
 
-func (r *Repository) CreatePRWithReviewers(ctx context.Context, pr model.PullRequest) error {
-	tx, err := r.db.BeginTx(ctx, nil)
+// LockUsers locks the given user rows until the end of the current
+// transaction and returns their current state. Unknown ids are skipped.
+func (r *Repository) LockUsers(ctx context.Context, userIDs []string) ([]model.User, error) {
+	rows, err := r.q(ctx).QueryContext(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		WHERE id = ANY($1)
+		ORDER BY id
+		FOR UPDATE
+	`, pq.Array(userIDs))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer tx.Rollback()
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (r *Repository) CreatePRWithReviewers(ctx context.Context, pr model.PullRequest) error {
+	return r.InTx(ctx, func(ctx context.Context) error {
+		return r.createPRWithReviewers(ctx, pr)
+	})
+}
+
+func (r *Repository) createPRWithReviewers(ctx context.Context, pr model.PullRequest) error {
+	tx := r.q(ctx)
 
 	var exists bool
 	if err := tx.QueryRowContext(ctx,
@@ -220,61 +704,93 @@ func (r *Repository) CreatePRWithReviewers(ctx context.Context, pr model.PullReq
 
 	now := time.Now().UTC()
 	if _, err := tx.ExecContext(ctx, `
-		INSERT INTO pull_requests (id, name, author_id, status, created_at)
-		VALUES ($1, $2, $3, $4, $5)
-	`, pr.ID, pr.Name, pr.AuthorID, string(pr.Status), now); err != nil {
+		INSERT INTO pull_requests (id, name, author_id, status, created_at, required_tags)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, pr.ID, pr.Name, pr.AuthorID, string(pr.Status), now, pq.Array(append([]string{}, pr.RequiredTags...))); err != nil {
+		if isUniqueViolation(err) {
+			return ErrPRExists
+		}
 		return err
 	}
 
-	for _, reviewer := range pr.AssignedReviewers {
+	for _, path := range pr.ChangedFiles {
 		if _, err := tx.ExecContext(ctx, `
-			INSERT INTO pull_request_reviewers (pull_request_id, reviewer_id)
+			INSERT INTO pull_request_files (pull_request_id, path)
 			VALUES ($1, $2)
-		`, pr.ID, reviewer); err != nil {
+			ON CONFLICT DO NOTHING
+		`, pr.ID, path); err != nil {
 			return err
 		}
 	}
 
-	return tx.Commit()
+	for _, rv := range pr.Reviews {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO pull_request_reviewers (pull_request_id, reviewer_id, source_team)
+			VALUES ($1, $2, NULLIF($3, ''))
+		`, pr.ID, rv.ReviewerID, rv.SourceTeam); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func (r *Repository) GetPR(ctx context.Context, prID string) (model.PullRequest, error) {
-	row := r.db.QueryRowContext(ctx, `
-		SELECT id, name, author_id, status, created_at, merged_at
-		FROM pull_requests
-		WHERE id = $1
-	`, prID)
+const prColumns = "id, name, author_id, status, created_at, merged_at, closed_at, force_merged, COALESCE(forced_by, ''), forced_at, required_tags"
 
+// scanPR reads a pull_requests row selected with prColumns and loads its reviewers.
+func (r *Repository) scanPR(ctx context.Context, row *sql.Row) (model.PullRequest, error) {
 	var (
 		id, name, authorID, statusStr string
 		createdAt                     time.Time
-		mergedAt                      *time.Time
+		mergedAt, closedAt, forcedAt  *time.Time
+		forceMerged                   bool
+		forcedBy                      string
+		requiredTags                  []string
 	)
-	if err := row.Scan(&id, &name, &authorID, &statusStr, &createdAt, &mergedAt); err != nil {
+	if err := row.Scan(&id, &name, &authorID, &statusStr, &createdAt, &mergedAt, &closedAt,
+		&forceMerged, &forcedBy, &forcedAt, pq.Array(&requiredTags)); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return model.PullRequest{}, ErrPRNotFound
 		}
 		return model.PullRequest{}, err
 	}
 
-	reviewerRows, err := r.db.QueryContext(ctx, `
-		SELECT reviewer_id
+	reviewerRows, err := r.q(ctx).QueryContext(ctx, `
+		SELECT reviewer_id, state, assigned_at, reviewed_at, COALESCE(source_team, '')
 		FROM pull_request_reviewers
 		WHERE pull_request_id = $1
 		ORDER BY reviewer_id
-	`, prID)
+	`, id)
 	if err != nil {
 		return model.PullRequest{}, err
 	}
 	defer reviewerRows.Close()
 
-	var reviewers []string
+	var (
+		reviewers []string
+		reviews   []model.Review
+	)
 	for reviewerRows.Next() {
-		var rid string
-		if err := reviewerRows.Scan(&rid); err != nil {
+		var (
+			rv         model.Review
+			state      string
+			assignedAt time.Time
+		)
+		if err := reviewerRows.Scan(&rv.ReviewerID, &state, &assignedAt, &rv.ReviewedAt, &rv.SourceTeam); err != nil {
 			return model.PullRequest{}, err
 		}
-		reviewers = append(reviewers, rid)
+		rv.State = model.ReviewState(state)
+		rv.AssignedAt = &assignedAt
+		reviewers = append(reviewers, rv.ReviewerID)
+		reviews = append(reviews, rv)
+	}
+	if err := reviewerRows.Err(); err != nil {
+		return model.PullRequest{}, err
+	}
+
+	files, err := r.getPRFiles(ctx, id)
+	if err != nil {
+		return model.PullRequest{}, err
 	}
 
 	return model.PullRequest{
@@ -283,70 +799,108 @@ func (r *Repository) GetPR(ctx context.Context, prID string) (model.PullRequest,
 		AuthorID:          authorID,
 		Status:            model.PullRequestStatus(statusStr),
 		AssignedReviewers: reviewers,
+		Reviews:           reviews,
 		CreatedAt:         &createdAt,
 		MergedAt:          mergedAt,
+		ClosedAt:          closedAt,
+		ForceMerged:       forceMerged,
+		ForcedBy:          forcedBy,
+		ForcedAt:          forcedAt,
+		ChangedFiles:      files,
+		RequiredTags:      requiredTags,
 	}, nil
 }
 
-func (r *Repository) MarkPRMerged(ctx context.Context, prID string) (model.PullRequest, error) {
-	row := r.db.QueryRowContext(ctx, `
+func (r *Repository) getPRFiles(ctx context.Context, prID string) ([]string, error) {
+	rows, err := r.q(ctx).QueryContext(ctx,
+		"SELECT path FROM pull_request_files WHERE pull_request_id = $1 ORDER BY path", prID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		files = append(files, path)
+	}
+	return files, rows.Err()
+}
+
+func (r *Repository) GetPR(ctx context.Context, prID string) (model.PullRequest, error) {
+	return r.scanPR(ctx, r.q(ctx).QueryRowContext(ctx,
+		"SELECT "+prColumns+" FROM pull_requests WHERE id = $1", prID))
+}
+
+// LockPR is GetPR that also locks the pull request row until the end of the
+// current transaction (see InTx).
+func (r *Repository) LockPR(ctx context.Context, prID string) (model.PullRequest, error) {
+	return r.scanPR(ctx, r.q(ctx).QueryRowContext(ctx,
+		"SELECT "+prColumns+" FROM pull_requests WHERE id = $1 FOR UPDATE", prID))
+}
+
+// MarkPRMerged sets the MERGED status. A non-empty forcedBy records who
+// bypassed the approval policy, and when.
+func (r *Repository) MarkPRMerged(ctx context.Context, prID, forcedBy string) (model.PullRequest, error) {
+	return r.scanPR(ctx, r.q(ctx).QueryRowContext(ctx, `
 		UPDATE pull_requests
 		SET status = 'MERGED',
-		    merged_at = COALESCE(merged_at, now())
+		    merged_at = COALESCE(merged_at, now()),
+		    force_merged = force_merged OR $2 <> '',
+		    forced_by = CASE WHEN $2 <> '' AND NOT force_merged THEN $2 ELSE forced_by END,
+		    forced_at = CASE WHEN $2 <> '' AND NOT force_merged THEN now() ELSE forced_at END
 		WHERE id = $1
-		RETURNING id, name, author_id, status, created_at, merged_at
-	`, prID)
-
-	var (
-		id, name, authorID, statusStr string
-		createdAt                     time.Time
-		mergedAt                      *time.Time
-	)
+		RETURNING `+prColumns, prID, forcedBy))
+}
 
-	if err := row.Scan(&id, &name, &authorID, &statusStr, &createdAt, &mergedAt); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return model.PullRequest{}, ErrPRNotFound
-		}
-		return model.PullRequest{}, err
+func (r *Repository) SetPRStatus(ctx context.Context, prID string, status model.PullRequestStatus) error {
+	res, err := r.q(ctx).ExecContext(ctx, `
+		UPDATE pull_requests
+		SET status = $2,
+		    closed_at = CASE WHEN $2 = 'CLOSED' THEN now() END
+		WHERE id = $1 AND status <> 'MERGED'
+	`, prID, string(status))
+	if err != nil {
+		return err
 	}
-
-	reviewerRows, err := r.db.QueryContext(ctx, `
-		SELECT reviewer_id
-		FROM pull_request_reviewers
-		WHERE pull_request_id = $1
-		ORDER BY reviewer_id
-	`, prID)
+	affected, err := res.RowsAffected()
 	if err != nil {
-		return model.PullRequest{}, err
+		return err
 	}
-	defer reviewerRows.Close()
+	if affected == 0 {
+		return ErrPRNotFound
+	}
+	return nil
+}
 
-	var reviewers []string
-	for reviewerRows.Next() {
-		var rid string
-		if err := reviewerRows.Scan(&rid); err != nil {
-			return model.PullRequest{}, err
+func (r *Repository) AddReviewers(ctx context.Context, prID string, reviews []model.Review) error {
+	for _, rv := range reviews {
+		if _, err := r.q(ctx).ExecContext(ctx, `
+			INSERT INTO pull_request_reviewers (pull_request_id, reviewer_id, source_team)
+			VALUES ($1, $2, NULLIF($3, ''))
+			ON CONFLICT DO NOTHING
+		`, prID, rv.ReviewerID, rv.SourceTeam); err != nil {
+			return err
 		}
-		reviewers = append(reviewers, rid)
 	}
-
-	return model.PullRequest{
-		ID:                id,
-		Name:              name,
-		AuthorID:          authorID,
-		Status:            model.PullRequestStatus(statusStr),
-		AssignedReviewers: reviewers,
-		CreatedAt:         &createdAt,
-		MergedAt:          mergedAt,
-	}, nil
+	return nil
 }
 
-func (r *Repository) ReassignReviewer(ctx context.Context, prID, oldReviewerID, newReviewerID string) error {
-	res, err := r.db.ExecContext(ctx, `
+// ReassignReviewer replaces oldReviewerID with replacement.ReviewerID, whose
+// review starts over as PENDING.
+func (r *Repository) ReassignReviewer(ctx context.Context, prID, oldReviewerID string, replacement model.Review) error {
+	res, err := r.q(ctx).ExecContext(ctx, `
 		UPDATE pull_request_reviewers
-		SET reviewer_id = $3
+		SET reviewer_id = $3,
+		    state = 'PENDING',
+		    assigned_at = now(),
+		    reviewed_at = NULL,
+		    source_team = NULLIF($4, '')
 		WHERE pull_request_id = $1 AND reviewer_id = $2
-	`, prID, oldReviewerID, newReviewerID)
+	`, prID, oldReviewerID, replacement.ReviewerID, replacement.SourceTeam)
 	if err != nil {
 		return err
 	}
@@ -360,8 +914,33 @@ func (r *Repository) ReassignReviewer(ctx context.Context, prID, oldReviewerID,
 	return nil
 }
 
+// SetReviewState records a reviewer's decision. A COMMENTED review does not
+// replace an earlier APPROVED or CHANGES_REQUESTED state.
+func (r *Repository) SetReviewState(ctx context.Context, prID, reviewerID string, state model.ReviewState) error {
+	res, err := r.q(ctx).ExecContext(ctx, `
+		UPDATE pull_request_reviewers
+		SET state = CASE
+		        WHEN $3::text = 'COMMENTED' AND state IN ('APPROVED', 'CHANGES_REQUESTED') THEN state
+		        ELSE $3::text
+		    END,
+		    reviewed_at = now()
+		WHERE pull_request_id = $1 AND reviewer_id = $2
+	`, prID, reviewerID, string(state))
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotAssigned
+	}
+	return nil
+}
+
 func (r *Repository) GetPRsForReviewer(ctx context.Context, userID string) ([]model.PullRequestShort, error) {
-	rows, err := r.db.QueryContext(ctx, `
+	rows, err := r.q(ctx).QueryContext(ctx, `
 		SELECT p.id, p.name, p.author_id, p.status
 		FROM pull_requests p
 		JOIN pull_request_reviewers r ON p.id = r.pull_request_id
@@ -386,13 +965,52 @@ func (r *Repository) GetPRsForReviewer(ctx context.Context, userID string) ([]mo
 	return res, nil
 }
 
-func (r *Repository) GetReviewerStats(ctx context.Context) ([]model.ReviewerStatsItem, error) {
-	rows, err := r.db.QueryContext(ctx, `
-		SELECT reviewer_id, COUNT(*) AS cnt
-		FROM pull_request_reviewers
-		GROUP BY reviewer_id
-		ORDER BY cnt DESC, reviewer_id
-	`)
+// GetPRsByTeam returns the pull requests authored by the current members of
+// the team.
+func (r *Repository) GetPRsByTeam(ctx context.Context, teamName string) ([]model.PullRequestShort, error) {
+	rows, err := r.q(ctx).QueryContext(ctx, `
+		SELECT p.id, p.name, p.author_id, p.status
+		FROM pull_requests p
+		JOIN users u ON u.id = p.author_id
+		WHERE u.team_name = $1
+		ORDER BY p.created_at DESC
+	`, teamName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []model.PullRequestShort
+	for rows.Next() {
+		var s model.PullRequestShort
+		var status string
+		if err := rows.Scan(&s.ID, &s.Name, &s.AuthorID, &status); err != nil {
+			return nil, err
+		}
+		s.Status = model.PullRequestStatus(status)
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
+
+func (r *Repository) GetReviewerStats(ctx context.Context, f model.ReviewerStatsFilter) ([]model.ReviewerStatsItem, error) {
+	rows, err := r.q(ctx).QueryContext(ctx, `
+		SELECT u.id, COALESCE(u.team_name, ''), u.is_active,
+		       COUNT(p.id) AS cnt,
+		       COUNT(p.id) FILTER (WHERE p.status = 'OPEN'),
+		       COUNT(p.id) FILTER (WHERE p.status IN ('MERGED', 'CLOSED'))
+		FROM users u
+		LEFT JOIN pull_request_reviewers r
+		       ON r.reviewer_id = u.id
+		      AND ($1::timestamptz IS NULL OR r.assigned_at >= $1)
+		      AND ($2::timestamptz IS NULL OR r.assigned_at < $2)
+		LEFT JOIN pull_requests p
+		       ON p.id = r.pull_request_id
+		      AND ($3::text = '' OR p.status = $3)
+		WHERE $4::text = '' OR u.team_name = $4
+		GROUP BY u.id
+		ORDER BY cnt DESC, u.id
+	`, f.From, f.To, string(f.Status), f.TeamName)
 	if err != nil {
 		return nil, err
 	}
@@ -401,15 +1019,126 @@ func (r *Repository) GetReviewerStats(ctx context.Context) ([]model.ReviewerStat
 	var res []model.ReviewerStatsItem
 	for rows.Next() {
 		var item model.ReviewerStatsItem
-		if err := rows.Scan(&item.UserID, &item.ReviewCount); err != nil {
+		if err := rows.Scan(&item.UserID, &item.TeamName, &item.IsActive,
+			&item.ReviewCount, &item.OpenCount, &item.CompletedCount); err != nil {
 			return nil, err
 		}
 		res = append(res, item)
 	}
-	return res, nil
+	return res, rows.Err()
 }
+
+func (r *Repository) GetOpenReviewCounts(ctx context.Context, userIDs []string) (map[string]int, error) {
+	rows, err := r.q(ctx).QueryContext(ctx, `
+		SELECT r.reviewer_id, COUNT(*)
+		FROM pull_request_reviewers r
+		JOIN pull_requests p ON p.id = r.pull_request_id
+		WHERE p.status = 'OPEN' AND r.reviewer_id = ANY($1)
+		GROUP BY r.reviewer_id
+	`, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[string]int, len(userIDs))
+	for rows.Next() {
+		var (
+			userID string
+			cnt    int
+		)
+		if err := rows.Scan(&userID, &cnt); err != nil {
+			return nil, err
+		}
+		res[userID] = cnt
+	}
+	return res, rows.Err()
+}
+
+func (r *Repository) GetPRTimes(ctx context.Context, teamName string, since time.Time) ([]model.PRTimes, error) {
+	rows, err := r.q(ctx).QueryContext(ctx, `
+		SELECT p.id, p.author_id, COALESCE(u.team_name, ''), p.status, p.created_at, p.merged_at
+		FROM pull_requests p
+		JOIN users u ON u.id = p.author_id
+		WHERE ($1::text = '' OR u.team_name = $1)
+		  AND (p.created_at >= $2 OR p.merged_at >= $2 OR p.status = 'OPEN')
+		ORDER BY p.created_at, p.id
+	`, teamName, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []model.PRTimes
+	for rows.Next() {
+		var (
+			pt     model.PRTimes
+			status string
+		)
+		if err := rows.Scan(&pt.ID, &pt.AuthorID, &pt.TeamName, &status, &pt.CreatedAt, &pt.MergedAt); err != nil {
+			return nil, err
+		}
+		pt.Status = model.PullRequestStatus(status)
+		res = append(res, pt)
+	}
+	return res, rows.Err()
+}
+
+func (r *Repository) GetPairCounts(ctx context.Context, authorID string, reviewerIDs []string, since time.Time) (map[string]int, error) {
+	rows, err := r.q(ctx).QueryContext(ctx, `
+		SELECT r.reviewer_id, COUNT(*)
+		FROM pull_request_reviewers r
+		JOIN pull_requests p ON p.id = r.pull_request_id
+		WHERE p.author_id = $1 AND r.reviewer_id = ANY($2) AND r.assigned_at >= $3
+		GROUP BY r.reviewer_id
+	`, authorID, pq.Array(reviewerIDs), since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[string]int, len(reviewerIDs))
+	for rows.Next() {
+		var (
+			userID string
+			cnt    int
+		)
+		if err := rows.Scan(&userID, &cnt); err != nil {
+			return nil, err
+		}
+		res[userID] = cnt
+	}
+	return res, rows.Err()
+}
+
+func (r *Repository) GetTeamPairings(ctx context.Context, teamName string, since *time.Time) ([]model.PairCount, error) {
+	rows, err := r.q(ctx).QueryContext(ctx, `
+		SELECT p.author_id, r.reviewer_id, COUNT(*)
+		FROM pull_request_reviewers r
+		JOIN pull_requests p ON p.id = r.pull_request_id
+		JOIN users a ON a.id = p.author_id
+		WHERE a.team_name = $1 AND ($2::timestamptz IS NULL OR r.assigned_at >= $2)
+		GROUP BY p.author_id, r.reviewer_id
+		ORDER BY p.author_id, r.reviewer_id
+	`, teamName, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []model.PairCount
+	for rows.Next() {
+		var pc model.PairCount
+		if err := rows.Scan(&pc.AuthorID, &pc.ReviewerID, &pc.Count); err != nil {
+			return nil, err
+		}
+		res = append(res, pc)
+	}
+	return res, rows.Err()
+}
+
 func (r *Repository) RemoveReviewer(ctx context.Context, prID, reviewerID string) error {
-	_, err := r.db.ExecContext(ctx, `
+	_, err := r.q(ctx).ExecContext(ctx, `
 		DELETE FROM pull_request_reviewers
 		WHERE pull_request_id = $1 AND reviewer_id = $2
 	`, prID, reviewerID)
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Mavichy/AvitoNovember/internal/logging"
+	"github.com/Mavichy/AvitoNovember/internal/model"
+	"github.com/Mavichy/AvitoNovember/internal/repository"
+)
+
+// SetUserAbsences replaces the user's absence schedule. If one of the
+// absences is already in progress, the user's open reviews are handed over
+// right away; the returned changes describe that.
+func (s *Service) SetUserAbsences(ctx context.Context, userID string, absences []model.Absence) ([]ReviewerChange, error) {
+	var changes []ReviewerChange
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.SetAbsences(ctx, userID, absences); err != nil {
+			return err
+		}
+
+		var err error
+		changes, err = s.processStartedAbsences(ctx, userID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, NewDomainError(model.ErrorCodeNotFound, "user not found")
+		}
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (s *Service) GetUserAbsences(ctx context.Context, userID string) ([]model.Absence, error) {
+	absences, err := s.repo.GetAbsences(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, NewDomainError(model.ErrorCodeNotFound, "user not found")
+		}
+		return nil, err
+	}
+	return absences, nil
+}
+
+// ProcessStartedAbsences reassigns the open reviews of every user whose
+// absence has started since the last call. It is meant to be run
+// periodically. Each user is handled in a transaction of their own, so a
+// failure is logged and does not hold up the others; the absence is retried
+// on the next call.
+func (s *Service) ProcessStartedAbsences(ctx context.Context) ([]ReviewerChange, error) {
+	userIDs, err := s.repo.GetUsersWithStartedAbsences(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []ReviewerChange
+	for _, userID := range userIDs {
+		var userChanges []ReviewerChange
+		err := s.inTx(ctx, func(ctx context.Context) error {
+			var err error
+			userChanges, err = s.processStartedAbsences(ctx, userID)
+			return err
+		})
+		if err != nil {
+			logging.FromContext(ctx).ErrorContext(ctx, "process started absence",
+				"user_id", userID, "error", err)
+			continue
+		}
+		changes = append(changes, userChanges...)
+	}
+	return changes, nil
+}
+
+// processStartedAbsences handles the started absences of userID. Open
+// reviews are released the same way as on bulk deactivation. Must run in a
+// transaction.
+func (s *Service) processStartedAbsences(ctx context.Context, userID string) ([]ReviewerChange, error) {
+	absences, err := s.repo.ClaimStartedAbsences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(absences) == 0 {
+		return nil, nil
+	}
+	if err := s.lockReviewedPRs(ctx, []string{userID}); err != nil {
+		return nil, err
+	}
+
+	prs, err := s.repo.GetPRsForReviewer(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []ReviewerChange
+	for _, prShort := range prs {
+		if prShort.Status != model.StatusOpen {
+			continue
+		}
+
+		change, changed, err := s.releaseReviewer(ctx, prShort.ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			changes = append(changes, change)
+		}
+	}
+
+	for _, a := range absences {
+		if err := s.repo.MarkAbsenceHandled(ctx, a.ID); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
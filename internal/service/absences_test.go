@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+	"github.com/Mavichy/AvitoNovember/internal/repository"
+)
+
+func absence(from, to time.Duration) []model.Absence {
+	now := time.Now()
+	return []model.Absence{{StartsAt: now.Add(from), EndsAt: now.Add(to), Reason: "vacation"}}
+}
+
+func TestAbsences(t *testing.T) {
+	ctx := context.Background()
+	svc, repo := newTestService(t)
+	addTestTeam(t, svc, "backend", "a", "b", "c", "d")
+
+	pr, err := svc.CreatePR(ctx, CreatePRInput{ID: "p1", Name: "p1", AuthorID: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	absent := pr.AssignedReviewers[0]
+
+	// A future absence changes nothing yet.
+	changes, err := svc.SetUserAbsences(ctx, absent, absence(time.Hour, 2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("changes for a future absence = %+v", changes)
+	}
+
+	// An absence that started since is picked up by the watcher, once.
+	if err := repo.SetAbsences(ctx, absent, absence(-time.Minute, time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	changes, err = svc.ProcessStartedAbsences(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].OldReviewerID != absent || changes[0].NewReviewerID == "" {
+		t.Fatalf("changes = %+v", changes)
+	}
+	if changes, err = svc.ProcessStartedAbsences(ctx); err != nil || len(changes) != 0 {
+		t.Fatalf("second run: changes %+v, err %v", changes, err)
+	}
+
+	// An absent user is not picked for new pull requests.
+	for _, id := range []string{"p2", "p3", "p4"} {
+		pr, err := svc.CreatePR(ctx, CreatePRInput{ID: id, Name: id, AuthorID: "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contains(pr.AssignedReviewers, absent) {
+			t.Fatalf("%s reviewers = %v include absent %s", id, pr.AssignedReviewers, absent)
+		}
+	}
+
+	got, err := svc.GetUserAbsences(ctx, absent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Reason != "vacation" {
+		t.Fatalf("absences = %+v", got)
+	}
+	_, err = svc.SetUserAbsences(ctx, "nobody", nil)
+	wantCode(t, err, model.ErrorCodeNotFound)
+}
+
+// claimFailingStore fails to claim the absences of one user.
+type claimFailingStore struct {
+	*repository.MemoryRepository
+	userID string
+}
+
+func (s *claimFailingStore) ClaimStartedAbsences(ctx context.Context, userID string) ([]model.Absence, error) {
+	if userID == s.userID {
+		return nil, errors.New("claim failed")
+	}
+	return s.MemoryRepository.ClaimStartedAbsences(ctx, userID)
+}
+
+// A user whose absence cannot be processed does not hold up the others and
+// is retried on the next run.
+func TestProcessStartedAbsencesIsolatesFailures(t *testing.T) {
+	ctx := context.Background()
+	store := &claimFailingStore{MemoryRepository: repository.NewMemoryRepository()}
+	selectors, err := NewSelectors(StrategyRoundRobin, nil, nil, NewRand(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewService(store, WithSelectors(selectors))
+	addTestTeam(t, svc, "backend", "a", "b", "c", "d")
+	if _, err := svc.CreatePR(ctx, CreatePRInput{ID: "p", Name: "p", AuthorID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	pr, err := store.GetPR(ctx, "p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing, ok := pr.AssignedReviewers[0], pr.AssignedReviewers[1]
+	store.userID = failing
+	for _, id := range pr.AssignedReviewers {
+		if err := store.SetAbsences(ctx, id, absence(-time.Minute, time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes, err := svc.ProcessStartedAbsences(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].OldReviewerID != ok {
+		t.Fatalf("changes = %+v, want only %s released", changes, ok)
+	}
+
+	store.userID = ""
+	changes, err = svc.ProcessStartedAbsences(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].OldReviewerID != failing {
+		t.Fatalf("retry changes = %+v, want %s released", changes, failing)
+	}
+}
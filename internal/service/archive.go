@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+	"github.com/Mavichy/AvitoNovember/internal/repository"
+)
+
+// ArchiveTeamResult is the archived team, the pull requests of its members
+// that are still in progress and need attention, and the reviews its members
+// held on other teams' pull requests.
+type ArchiveTeamResult struct {
+	Team             model.Team               `json:"team"`
+	OpenPullRequests []model.PullRequestShort `json:"open_pull_requests"`
+	ReleasedReviews  []ReviewerChange         `json:"released_reviews"`
+}
+
+type DeleteTeamResult struct {
+	TeamName string `json:"team_name"`
+	// DetachedUsers are the former members, now without a team.
+	DetachedUsers []string `json:"detached_users"`
+	// ReleasedReviews are the open reviews the former members held.
+	ReleasedReviews []ReviewerChange `json:"released_reviews"`
+}
+
+// ArchiveTeam makes the team read-only: its members can no longer open pull
+// requests or be added to it. Pull requests already in progress are left to
+// their reviewers and returned, so they can be finished or closed. Open
+// reviews the members hold on other teams' pull requests are handed back to
+// those teams.
+func (s *Service) ArchiveTeam(ctx context.Context, teamName string) (ArchiveTeamResult, error) {
+	var res ArchiveTeamResult
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.SetTeamArchived(ctx, teamName, true); err != nil {
+			return err
+		}
+
+		prs, err := s.repo.GetPRsByTeam(ctx, teamName)
+		if err != nil {
+			return err
+		}
+		for _, pr := range prs {
+			if pr.Status == model.StatusOpen || pr.Status == model.StatusDraft {
+				res.OpenPullRequests = append(res.OpenPullRequests, pr)
+			}
+		}
+
+		res.Team, err = s.repo.GetTeam(ctx, teamName)
+		if err != nil {
+			return err
+		}
+		res.ReleasedReviews, err = s.releaseOutsideReviews(ctx, res.Team)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrTeamNotFound) {
+			return ArchiveTeamResult{}, NewDomainError(model.ErrorCodeNotFound, "team not found")
+		}
+		return ArchiveTeamResult{}, err
+	}
+	return res, nil
+}
+
+// releaseOutsideReviews takes the members of team off the open pull requests
+// of other teams, where they were assigned through fallback teams or the
+// hierarchy, and tops those pull requests up from their authors' teams. Must
+// run in a transaction.
+func (s *Service) releaseOutsideReviews(ctx context.Context, team model.Team) ([]ReviewerChange, error) {
+	memberIDs := make([]string, 0, len(team.Members))
+	for _, m := range team.Members {
+		memberIDs = append(memberIDs, m.UserID)
+	}
+	if err := s.lockReviewedPRs(ctx, memberIDs); err != nil {
+		return nil, err
+	}
+
+	changes := []ReviewerChange{}
+	for _, uid := range memberIDs {
+		prs, err := s.repo.GetPRsForReviewer(ctx, uid)
+		if err != nil {
+			return nil, err
+		}
+		for _, prShort := range prs {
+			if prShort.Status != model.StatusOpen {
+				continue
+			}
+			pr, err := s.repo.LockPR(ctx, prShort.ID)
+			if err != nil {
+				return nil, err
+			}
+			author, err := s.repo.GetUser(ctx, pr.AuthorID)
+			if err != nil {
+				return nil, err
+			}
+			if author.TeamName == team.TeamName {
+				continue
+			}
+
+			if err := s.repo.RemoveReviewer(ctx, pr.ID, uid); err != nil {
+				return nil, err
+			}
+			change := ReviewerChange{PullRequestID: pr.ID, OldReviewerID: uid}
+			if change.NewReviewerID, err = s.refillReviewer(ctx, pr.ID); err != nil {
+				return nil, err
+			}
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// refillReviewer tops the pull request up to its team's reviewer count and
+// returns the reviewer added, if any. A required code owner that cannot be
+// replaced does not stop the caller.
+func (s *Service) refillReviewer(ctx context.Context, prID string) (string, error) {
+	pr, err := s.repo.GetPR(ctx, prID)
+	if err != nil {
+		return "", err
+	}
+	err = s.fillReviewers(ctx, pr)
+	if de, ok := AsDomainError(err); ok && de.Code == model.ErrorCodeNoCodeOwner {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	updated, err := s.repo.GetPR(ctx, prID)
+	if err != nil {
+		return "", err
+	}
+	for _, id := range updated.AssignedReviewers {
+		if !contains(pr.AssignedReviewers, id) {
+			return id, nil
+		}
+	}
+	return "", nil
+}
+
+func (s *Service) UnarchiveTeam(ctx context.Context, teamName string) (model.Team, error) {
+	if err := s.repo.SetTeamArchived(ctx, teamName, false); err != nil {
+		if errors.Is(err, repository.ErrTeamNotFound) {
+			return model.Team{}, NewDomainError(model.ErrorCodeNotFound, "team not found")
+		}
+		return model.Team{}, err
+	}
+	return s.repo.GetTeam(ctx, teamName)
+}
+
+// DeleteTeam deletes an archived team. Its members stay without a team, so
+// their pull requests and review history remain available. Their open
+// reviews are handed over to the authors' teams, or dropped when there is
+// nobody to take them.
+func (s *Service) DeleteTeam(ctx context.Context, teamName string) (DeleteTeamResult, error) {
+	res := DeleteTeamResult{TeamName: teamName, ReleasedReviews: []ReviewerChange{}}
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		archived, err := s.repo.IsTeamArchived(ctx, teamName)
+		if err != nil {
+			return err
+		}
+		if !archived {
+			return NewDomainError(model.ErrorCodeTeamNotArchived, "team "+teamName+" must be archived before deletion")
+		}
+
+		team, err := s.repo.GetTeam(ctx, teamName)
+		if err != nil {
+			return err
+		}
+		memberIDs := make([]string, 0, len(team.Members))
+		for _, m := range team.Members {
+			memberIDs = append(memberIDs, m.UserID)
+		}
+		if err := s.lockReviewedPRs(ctx, memberIDs); err != nil {
+			return err
+		}
+
+		res.DetachedUsers, err = s.repo.DeleteTeam(ctx, teamName)
+		if err != nil {
+			return err
+		}
+
+		// Released after detaching, so that replacements are not picked
+		// from the deleted team.
+		for _, uid := range res.DetachedUsers {
+			prs, err := s.repo.GetPRsForReviewer(ctx, uid)
+			if err != nil {
+				return err
+			}
+			for _, prShort := range prs {
+				if prShort.Status != model.StatusOpen {
+					continue
+				}
+				change, changed, err := s.releaseReviewer(ctx, prShort.ID, uid)
+				if err != nil {
+					return err
+				}
+				if changed {
+					res.ReleasedReviews = append(res.ReleasedReviews, change)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrTeamNotFound) {
+			return DeleteTeamResult{}, NewDomainError(model.ErrorCodeNotFound, "team not found")
+		}
+		return DeleteTeamResult{}, err
+	}
+	return res, nil
+}
+
+// checkTeamNotArchived returns TEAM_ARCHIVED if the team is archived.
+func (s *Service) checkTeamNotArchived(ctx context.Context, teamName string) error {
+	archived, err := s.repo.IsTeamArchived(ctx, teamName)
+	if err != nil {
+		return err
+	}
+	if archived {
+		return NewDomainError(model.ErrorCodeTeamArchived, "team "+teamName+" is archived")
+	}
+	return nil
+}
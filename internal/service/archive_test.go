@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+)
+
+func TestArchiveReleasesOutsideReviews(t *testing.T) {
+	ctx := context.Background()
+	svc, repo := newTestService(t)
+	addTestTeam(t, svc, "ops", "o1")
+	addTestTeam(t, svc, "backend", "u1", "u2")
+	fallbacks := []string{"ops"}
+	if _, err := svc.UpdateTeam(ctx, UpdateTeamInput{TeamName: "backend", FallbackTeams: &fallbacks}); err != nil {
+		t.Fatal(err)
+	}
+
+	pr, err := svc.CreatePR(ctx, CreatePRInput{ID: "pr-1", Name: "pr-1", AuthorID: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !contains(pr.AssignedReviewers, "o1") {
+		t.Fatalf("reviewers = %v, want fallback o1", pr.AssignedReviewers)
+	}
+
+	if _, err := svc.AddTeamMembers(ctx, "backend", []model.TeamMember{{UserID: "u3", Username: "u3", IsActive: true}}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := svc.ArchiveTeam(ctx, "ops")
+	if err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	want := ReviewerChange{PullRequestID: "pr-1", OldReviewerID: "o1", NewReviewerID: "u3"}
+	if len(res.ReleasedReviews) != 1 || res.ReleasedReviews[0] != want {
+		t.Fatalf("released = %+v, want %+v", res.ReleasedReviews, want)
+	}
+
+	pr, err = repo.GetPR(ctx, "pr-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contains(pr.AssignedReviewers, "o1") || !contains(pr.AssignedReviewers, "u3") {
+		t.Fatalf("reviewers after archive = %v", pr.AssignedReviewers)
+	}
+}
+
+// Deleting a team hands over its members' open reviews, so later moves,
+// absences and reassigns do not run into the deleted team.
+func TestDeleteTeamReleasesMembersReviews(t *testing.T) {
+	ctx := context.Background()
+	svc, repo := newTestService(t)
+	addTestTeam(t, svc, "new", "c", "n")
+	addTestTeam(t, svc, "old", "a", "b")
+	fallbacks := []string{"new"}
+	if _, err := svc.UpdateTeam(ctx, UpdateTeamInput{TeamName: "old", FallbackTeams: &fallbacks}); err != nil {
+		t.Fatal(err)
+	}
+
+	pr, err := svc.CreatePR(ctx, CreatePRInput{ID: "p", Name: "p", AuthorID: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pr.AssignedReviewers) != 2 || !contains(pr.AssignedReviewers, "b") {
+		t.Fatalf("reviewers = %v", pr.AssignedReviewers)
+	}
+	helper := removeID(pr.AssignedReviewers, "b")[0]
+	other := removeID([]string{"c", "n"}, helper)[0]
+
+	if _, err := svc.ArchiveTeam(ctx, "old"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := svc.DeleteTeam(ctx, "old")
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	// The author has no team any more, so b has no replacement.
+	want := ReviewerChange{PullRequestID: "p", OldReviewerID: "b"}
+	if len(res.ReleasedReviews) != 1 || res.ReleasedReviews[0] != want {
+		t.Fatalf("released = %+v, want %+v", res.ReleasedReviews, want)
+	}
+
+	moved, err := svc.MoveUser(ctx, "b", "new")
+	if err != nil {
+		t.Fatalf("move: %v", err)
+	}
+	if len(moved.Changes) != 0 {
+		t.Fatalf("move changes = %+v", moved.Changes)
+	}
+
+	changes, err := svc.SetUserAbsences(ctx, helper, []model.Absence{{
+		StartsAt: time.Now().Add(-time.Hour),
+		EndsAt:   time.Now().Add(time.Hour),
+	}})
+	if err != nil {
+		t.Fatalf("set absence: %v", err)
+	}
+	wantAbsence := ReviewerChange{PullRequestID: "p", OldReviewerID: helper, NewReviewerID: other}
+	if len(changes) != 1 || changes[0] != wantAbsence {
+		t.Fatalf("absence changes = %+v, want %+v", changes, wantAbsence)
+	}
+
+	_, err = svc.ReassignReviewer(ctx, "p", "b")
+	wantCode(t, err, model.ErrorCodeNotAssigned)
+
+	got, err := repo.GetPR(ctx, "p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.AssignedReviewers) != 1 || got.AssignedReviewers[0] != other {
+		t.Fatalf("reviewers after absence = %v, want [%s]", got.AssignedReviewers, other)
+	}
+}
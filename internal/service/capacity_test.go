@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+)
+
+func TestReviewCapacity(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	addTestTeam(t, svc, "backend", "a", "b", "c", "d")
+
+	one := 1
+	for _, id := range []string{"b", "c", "d"} {
+		u, err := svc.SetUserCapacity(ctx, id, &one)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.MaxOpenReviews == nil || *u.MaxOpenReviews != 1 {
+			t.Fatalf("%s capacity = %v", id, u.MaxOpenReviews)
+		}
+	}
+
+	p1, err := svc.CreatePR(ctx, CreatePRInput{ID: "p1", Name: "p1", AuthorID: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only one candidate has room left.
+	p2, err := svc.CreatePR(ctx, CreatePRInput{ID: "p2", Name: "p2", AuthorID: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := append(append([]string(nil), p1.AssignedReviewers...), p2.AssignedReviewers...)
+	sort.Strings(got)
+	if strings.Join(got, ",") != "b,c,d" {
+		t.Fatalf("reviewers = %v and %v, want b, c and d once each", p1.AssignedReviewers, p2.AssignedReviewers)
+	}
+
+	// Everyone is full.
+	_, err = svc.CreatePR(ctx, CreatePRInput{ID: "p3", Name: "p3", AuthorID: "a"})
+	wantCode(t, err, model.ErrorCodeNoCandidate)
+	_, err = svc.ReassignReviewer(ctx, "p1", p1.AssignedReviewers[0])
+	wantCode(t, err, model.ErrorCodeNoCandidate)
+
+	// A draft can still be opened, it just gets no reviewers.
+	if _, err := svc.CreatePR(ctx, CreatePRInput{ID: "p4", Name: "p4", AuthorID: "a", Draft: true}); err != nil {
+		t.Fatal(err)
+	}
+	p4, err := svc.MarkPRReady(ctx, "p4")
+	if err != nil {
+		t.Fatalf("markReady: %v", err)
+	}
+	if len(p4.AssignedReviewers) != 0 {
+		t.Fatalf("p4 reviewers = %v", p4.AssignedReviewers)
+	}
+
+	// Merged pull requests free their reviewers.
+	if _, err := svc.MergePR(ctx, "p2", ""); err != nil {
+		t.Fatal(err)
+	}
+	p5, err := svc.CreatePR(ctx, CreatePRInput{ID: "p5", Name: "p5", AuthorID: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(p5.AssignedReviewers, ",") != p2.AssignedReviewers[0] {
+		t.Fatalf("p5 reviewers = %v, want %v", p5.AssignedReviewers, p2.AssignedReviewers)
+	}
+
+	// Removing the limit makes the user available again.
+	if _, err := svc.SetUserCapacity(ctx, "b", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.CreatePR(ctx, CreatePRInput{ID: "p6", Name: "p6", AuthorID: "a"}); err != nil {
+		t.Fatalf("create after lifting the limit: %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Mavichy/AvitoNovember/internal/codeowners"
+	"github.com/Mavichy/AvitoNovember/internal/model"
+	"github.com/Mavichy/AvitoNovember/internal/repository"
+)
+
+// ownerGroup is a set of changed paths matched by one ownership rule,
+// with the owners that can currently review them.
+type ownerGroup struct {
+	path   string
+	owners []ownerCandidate
+}
+
+type ownerCandidate struct {
+	userID string
+	team   string
+}
+
+func (s *Service) GetCodeOwners(ctx context.Context, teamName string) (model.CodeOwners, error) {
+	co, err := s.repo.GetCodeOwners(ctx, teamName)
+	if err != nil {
+		if errors.Is(err, repository.ErrTeamNotFound) {
+			return model.CodeOwners{}, NewDomainError(model.ErrorCodeNotFound, "team not found")
+		}
+		return model.CodeOwners{}, err
+	}
+	return co, nil
+}
+
+// SetCodeOwners replaces the team's ownership rules. The rules must already
+// have been validated with codeowners.Parse.
+func (s *Service) SetCodeOwners(ctx context.Context, teamName string, co model.CodeOwners) (model.CodeOwners, error) {
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		if err := s.checkTeamNotArchived(ctx, teamName); err != nil {
+			return err
+		}
+		return s.repo.SetCodeOwners(ctx, teamName, co)
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrTeamNotFound) {
+			return model.CodeOwners{}, NewDomainError(model.ErrorCodeNotFound, "team not found")
+		}
+		return model.CodeOwners{}, err
+	}
+	return s.GetCodeOwners(ctx, teamName)
+}
+
+// codeOwnerGroups matches files against the rules of teamName and returns
+// one group per matching rule that names owners, in the order of files.
+// Owners that are unknown, inactive, absent or in an archived team are left out.
+func (s *Service) codeOwnerGroups(ctx context.Context, teamName string, files []string) ([]ownerGroup, model.CodeOwnersMode, error) {
+	if len(files) == 0 {
+		return nil, "", nil
+	}
+
+	co, err := s.repo.GetCodeOwners(ctx, teamName)
+	if err != nil {
+		return nil, "", err
+	}
+	rules, err := codeowners.Parse(co.Rules)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(rules) == 0 {
+		return nil, co.Mode, nil
+	}
+
+	active := make(map[string][]model.User)
+	activeIn := func(team string) ([]model.User, error) {
+		if users, ok := active[team]; ok {
+			return users, nil
+		}
+		archived, err := s.repo.IsTeamArchived(ctx, team)
+		if errors.Is(err, repository.ErrTeamNotFound) {
+			active[team] = nil
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if archived {
+			active[team] = nil
+			return nil, nil
+		}
+		users, err := s.repo.GetActiveUsersByTeam(ctx, team)
+		if err != nil {
+			return nil, err
+		}
+		active[team] = users
+		return users, nil
+	}
+
+	var groups []ownerGroup
+	seen := make(map[string]bool)
+	for _, path := range files {
+		rule, ok := rules.Match(path)
+		if !ok || len(rule.Owners) == 0 || seen[rule.Pattern] {
+			continue
+		}
+		seen[rule.Pattern] = true
+
+		g := ownerGroup{path: path}
+		add := func(u model.User) {
+			for _, c := range g.owners {
+				if c.userID == u.UserID {
+					return
+				}
+			}
+			g.owners = append(g.owners, ownerCandidate{userID: u.UserID, team: u.TeamName})
+		}
+
+		for _, owner := range rule.Owners {
+			userID, team := codeowners.ParseOwner(owner)
+			if team == "" {
+				u, err := s.repo.GetUser(ctx, userID)
+				if errors.Is(err, repository.ErrUserNotFound) {
+					continue
+				}
+				if err != nil {
+					return nil, "", err
+				}
+				if u.TeamName == "" {
+					continue
+				}
+				team = u.TeamName
+			}
+
+			users, err := activeIn(team)
+			if err != nil {
+				return nil, "", err
+			}
+			for _, u := range users {
+				if userID == "" || u.UserID == userID {
+					add(u)
+				}
+			}
+		}
+		groups = append(groups, g)
+	}
+	return groups, co.Mode, nil
+}
+
+func ownerUserIDs(groups []ownerGroup) []string {
+	var ids []string
+	for _, g := range groups {
+		for _, c := range g.owners {
+			ids = append(ids, c.userID)
+		}
+	}
+	return ids
+}
+
+// pickOwners picks one owner for each group not yet covered by assigned,
+// until max owners are picked, skipping exclude. Owners at capacity are
+// passed over. It also returns the paths of the groups left without an
+// available owner. locked must hold the rows of all owners.
+func (s *Service) pickOwners(ctx context.Context, authorID string, groups []ownerGroup, locked map[string]model.User, assigned, exclude []string, max int) ([]model.Review, []string, error) {
+	var (
+		res     []model.Review
+		unowned []string
+	)
+	covered := func(g ownerGroup) bool {
+		for _, c := range g.owners {
+			if contains(assigned, c.userID) || pickedIn(res, c.userID) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, g := range groups {
+		if len(res) >= max {
+			break
+		}
+		if covered(g) {
+			continue
+		}
+
+		// Owners are tried team by team so each team's strategy applies.
+		var teams []string
+		byTeam := make(map[string][]string)
+		for _, c := range g.owners {
+			if contains(exclude, c.userID) {
+				continue
+			}
+			if _, ok := byTeam[c.team]; !ok {
+				teams = append(teams, c.team)
+			}
+			byTeam[c.team] = append(byTeam[c.team], c.userID)
+		}
+
+		found := false
+		for _, team := range teams {
+			ids := stillActiveIn(locked, team, byTeam[team])
+			picked, err := s.selectReviewers(ctx, team, authorID, locked, ids, 1)
+			if de, ok := AsDomainError(err); ok && de.Code == model.ErrorCodeNoCandidate {
+				continue
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(picked) > 0 {
+				res = append(res, model.Review{ReviewerID: picked[0], SourceTeam: team})
+				found = true
+				break
+			}
+		}
+		if !found {
+			unowned = append(unowned, g.path)
+		}
+	}
+	return res, unowned, nil
+}
+
+func noCodeOwnerError(path string) error {
+	return NewDomainError(model.ErrorCodeNoCodeOwner, "no available code owner for "+path)
+}
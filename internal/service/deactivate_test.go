@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+)
+
+func TestDeactivateDryRunAndAtomicity(t *testing.T) {
+	ctx := context.Background()
+	svc, repo := newTestService(t)
+	addTestTeam(t, svc, "backend", "a", "b", "c", "d")
+
+	pr, err := svc.CreatePR(ctx, CreatePRInput{ID: "p", Name: "p", AuthorID: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviewers := pr.AssignedReviewers
+
+	// Repeated ids are deactivated once.
+	plan, err := svc.DeactivateTeamUsersAndReassign(ctx, "backend", []string{"b", "c", "b", "d"}, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if !plan.DryRun || !reflect.DeepEqual(plan.Deactivated, []string{"b", "c", "d"}) {
+		t.Fatalf("dry run result = %+v", plan)
+	}
+	if plan.RemovedReviewers != 2 || plan.AffectedPullRequests != 1 {
+		t.Fatalf("dry run result = %+v", plan)
+	}
+
+	// The dry run is rolled back.
+	assertActive(t, repo, "b", true)
+	got, err := repo.GetPR(ctx, "p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.AssignedReviewers, reviewers) {
+		t.Fatalf("reviewers after dry run = %v, want %v", got.AssignedReviewers, reviewers)
+	}
+
+	// An unknown user fails the whole request.
+	_, err = svc.DeactivateTeamUsersAndReassign(ctx, "backend", []string{"b", "nobody"}, false)
+	wantCode(t, err, model.ErrorCodeNotFound)
+	assertActive(t, repo, "b", true)
+
+	res, err := svc.DeactivateTeamUsersAndReassign(ctx, "backend", []string{"b", "c", "b", "d"}, false)
+	if err != nil {
+		t.Fatalf("deactivate: %v", err)
+	}
+	plan.DryRun = false
+	if !reflect.DeepEqual(res, plan) {
+		t.Fatalf("result = %+v, want the dry run plan %+v", res, plan)
+	}
+	assertActive(t, repo, "b", false)
+}
+
+func assertActive(t *testing.T, repo Store, userID string, want bool) {
+	t.Helper()
+	u, err := repo.GetUser(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.IsActive != want {
+		t.Fatalf("%s active = %v, want %v", userID, u.IsActive, want)
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+)
+
+// DefaultFairnessThreshold is the relative deviation from the team mean
+// beyond which a member is flagged as over- or under-assigned.
+const DefaultFairnessThreshold = 0.5
+
+const (
+	FairnessOver  = "over"
+	FairnessUnder = "under"
+)
+
+type FairnessMember struct {
+	UserID      string `json:"user_id"`
+	Assignments int    `json:"assignments"`
+	// Deviation is Assignments minus the team mean, DeviationPct the same
+	// relative to the mean.
+	Deviation    float64 `json:"deviation"`
+	DeviationPct float64 `json:"deviation_pct"`
+	// Flag is "over", "under" or empty.
+	Flag string `json:"flag,omitempty"`
+}
+
+// TeamFairness shows how evenly the team's active members were assigned
+// reviews. Gini is 0 for a perfectly even spread and approaches 1 when one
+// member gets everything. MaxMinRatio is nil when someone got nothing.
+type TeamFairness struct {
+	TeamName         string           `json:"team_name"`
+	Members          int              `json:"members"`
+	TotalAssignments int              `json:"total_assignments"`
+	Mean             float64          `json:"mean"`
+	Gini             float64          `json:"gini"`
+	MaxMinRatio      *float64         `json:"max_min_ratio"`
+	Items            []FairnessMember `json:"items"`
+}
+
+// GetFairness builds the fairness report of teamName, or of every team if it
+// is empty, from the review assignments made in [from, to). Members whose
+// count deviates from the mean by more than threshold (a fraction of the
+// mean) are flagged.
+func (s *Service) GetFairness(ctx context.Context, teamName string, from, to *time.Time, threshold float64) ([]TeamFairness, error) {
+	stats, err := s.GetReviewerStats(ctx, model.ReviewerStatsFilter{From: from, To: to, TeamName: teamName})
+	if err != nil {
+		return nil, err
+	}
+
+	teams := []string{teamName}
+	if teamName == "" {
+		if teams, err = s.subtree(ctx, ""); err != nil {
+			return nil, err
+		}
+		sort.Strings(teams)
+	}
+
+	byTeam := make(map[string][]model.ReviewerStatsItem)
+	for _, item := range stats {
+		if item.IsActive {
+			byTeam[item.TeamName] = append(byTeam[item.TeamName], item)
+		}
+	}
+
+	res := make([]TeamFairness, 0, len(teams))
+	for _, t := range teams {
+		res = append(res, teamFairness(t, byTeam[t], threshold))
+	}
+	return res, nil
+}
+
+func teamFairness(teamName string, items []model.ReviewerStatsItem, threshold float64) TeamFairness {
+	f := TeamFairness{
+		TeamName: teamName,
+		Members:  len(items),
+		Items:    []FairnessMember{},
+	}
+	if len(items) == 0 {
+		return f
+	}
+
+	minCount, maxCount := items[0].ReviewCount, items[0].ReviewCount
+	for _, item := range items {
+		f.TotalAssignments += item.ReviewCount
+		minCount = min(minCount, item.ReviewCount)
+		maxCount = max(maxCount, item.ReviewCount)
+	}
+	f.Mean = float64(f.TotalAssignments) / float64(len(items))
+	if minCount > 0 {
+		ratio := round2(float64(maxCount) / float64(minCount))
+		f.MaxMinRatio = &ratio
+	}
+
+	// Gini = Σ|xi - xj| / (2 n² mean)
+	var diffs float64
+	for _, a := range items {
+		for _, b := range items {
+			diffs += math.Abs(float64(a.ReviewCount - b.ReviewCount))
+		}
+	}
+	if f.Mean > 0 {
+		f.Gini = round2(diffs / (2 * float64(len(items)*len(items)) * f.Mean))
+	}
+
+	for _, item := range items {
+		m := FairnessMember{
+			UserID:      item.UserID,
+			Assignments: item.ReviewCount,
+			Deviation:   round2(float64(item.ReviewCount) - f.Mean),
+		}
+		if f.Mean > 0 {
+			rel := (float64(item.ReviewCount) - f.Mean) / f.Mean
+			m.DeviationPct = round2(rel * 100)
+			switch {
+			case rel > threshold:
+				m.Flag = FairnessOver
+			case rel < -threshold:
+				m.Flag = FairnessUnder
+			}
+		}
+		f.Items = append(f.Items, m)
+	}
+	f.Mean = round2(f.Mean)
+	return f
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+)
+
+func TestTeamFairness(t *testing.T) {
+	items := func(counts ...int) []model.ReviewerStatsItem {
+		var res []model.ReviewerStatsItem
+		for i, c := range counts {
+			res = append(res, model.ReviewerStatsItem{UserID: string(rune('a' + i)), ReviewCount: c})
+		}
+		return res
+	}
+	ratio := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name     string
+		counts   []int
+		gini     float64
+		mean     float64
+		maxMin   *float64
+		flags    []string
+		totalSum int
+	}{
+		{"no members", nil, 0, 0, nil, nil, 0},
+		{"all equal", []int{3, 3, 3, 3}, 0, 3, ratio(1), []string{"", "", "", ""}, 12},
+		{"all zero", []int{0, 0, 0}, 0, 0, nil, []string{"", "", ""}, 0},
+		{"single reviewer", []int{5}, 0, 5, ratio(1), []string{""}, 5},
+		// One of four members gets everything: Gini = (n-1)/n.
+		{"one takes all", []int{0, 8, 0, 0}, 0.75, 2, nil, []string{FairnessUnder, FairnessOver, FairnessUnder, FairnessUnder}, 8},
+		{"slightly uneven", []int{2, 2, 2, 1}, 0.11, 1.75, ratio(2), []string{"", "", "", ""}, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := teamFairness("backend", items(tt.counts...), DefaultFairnessThreshold)
+
+			if f.Members != len(tt.counts) || f.TotalAssignments != tt.totalSum {
+				t.Fatalf("members %d, total %d", f.Members, f.TotalAssignments)
+			}
+			if f.Gini != tt.gini || f.Mean != tt.mean {
+				t.Fatalf("gini %v, mean %v; want %v, %v", f.Gini, f.Mean, tt.gini, tt.mean)
+			}
+			switch {
+			case tt.maxMin == nil && f.MaxMinRatio != nil:
+				t.Fatalf("max/min ratio %v, want nil", *f.MaxMinRatio)
+			case tt.maxMin != nil && (f.MaxMinRatio == nil || *f.MaxMinRatio != *tt.maxMin):
+				t.Fatalf("max/min ratio %v, want %v", f.MaxMinRatio, *tt.maxMin)
+			}
+			if len(f.Items) != len(tt.flags) {
+				t.Fatalf("got %d items", len(f.Items))
+			}
+			for i, item := range f.Items {
+				if item.Flag != tt.flags[i] {
+					t.Errorf("%s flag %q, want %q", item.UserID, item.Flag, tt.flags[i])
+				}
+			}
+		})
+	}
+}
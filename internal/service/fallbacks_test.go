@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+)
+
+func TestFallbackTeamsValidation(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	addTestTeam(t, svc, "ops", "o1")
+
+	var ve *ValidationError
+	_, err := svc.AddTeam(ctx, model.Team{TeamName: "backend", FallbackTeams: []string{"backend"}})
+	if !errors.As(err, &ve) {
+		t.Fatalf("own fallback on add: got %v, want a validation error", err)
+	}
+
+	addTestTeam(t, svc, "backend", "a")
+	for _, fallbacks := range [][]string{{"backend"}, {"ops", "ops"}} {
+		_, err := svc.UpdateTeam(ctx, UpdateTeamInput{TeamName: "backend", FallbackTeams: &fallbacks})
+		if !errors.As(err, &ve) {
+			t.Fatalf("fallbacks %v: got %v, want a validation error", fallbacks, err)
+		}
+	}
+	team, err := svc.GetTeam(ctx, "backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(team.FallbackTeams) != 0 {
+		t.Fatalf("fallbacks = %v after rejected updates", team.FallbackTeams)
+	}
+}
+
+// The author's team is used first; fallback teams fill the rest, in order,
+// skipping archived ones, and each review records its source team.
+func TestFallbackPools(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	addTestTeam(t, svc, "archived", "x1")
+	addTestTeam(t, svc, "ops", "o1")
+	addTestTeam(t, svc, "qa", "q1", "q2")
+	addTestTeam(t, svc, "backend", "a", "b")
+	three := 3
+	fallbacks := []string{"archived", "ops", "qa"}
+	if _, err := svc.UpdateTeam(ctx, UpdateTeamInput{TeamName: "backend", ReviewerCount: &three, FallbackTeams: &fallbacks}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ArchiveTeam(ctx, "archived"); err != nil {
+		t.Fatal(err)
+	}
+
+	pr, err := svc.CreatePR(ctx, CreatePRInput{ID: "p", Name: "p", AuthorID: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := make(map[string]string)
+	for _, rv := range pr.Reviews {
+		sources[rv.ReviewerID] = rv.SourceTeam
+	}
+	if len(sources) != 3 || sources["b"] != "backend" || sources["o1"] != "ops" {
+		t.Fatalf("reviews = %+v", pr.Reviews)
+	}
+	var fromQA int
+	for _, id := range []string{"q1", "q2"} {
+		if sources[id] == "qa" {
+			fromQA++
+		}
+	}
+	if fromQA != 1 {
+		t.Fatalf("reviews = %+v, want one from qa", pr.Reviews)
+	}
+
+	// Without anyone left in the author's team the replacement comes from
+	// the fallbacks too.
+	rr, err := svc.ReassignReviewer(ctx, "p", "b")
+	if err != nil {
+		t.Fatalf("reassign: %v", err)
+	}
+	if rr.ReplacedBy != "q1" && rr.ReplacedBy != "q2" {
+		t.Fatalf("replaced by %q, want the other qa member", rr.ReplacedBy)
+	}
+	for _, rv := range rr.PR.Reviews {
+		if rv.ReviewerID == rr.ReplacedBy && rv.SourceTeam != "qa" {
+			t.Fatalf("replacement source team = %q, want qa", rv.SourceTeam)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+	"github.com/Mavichy/AvitoNovember/internal/repository"
+)
+
+// TeamStatsCounts are the counters of a team in /stats/teams.
+type TeamStatsCounts struct {
+	Members       int `json:"members"`
+	ActiveMembers int `json:"active_members"`
+	// ReviewAssignments counts review assignments held by the members.
+	ReviewAssignments  int `json:"review_assignments"`
+	OpenPullRequests   int `json:"open_pull_requests"`
+	MergedPullRequests int `json:"merged_pull_requests"`
+}
+
+func (c *TeamStatsCounts) add(o TeamStatsCounts) {
+	c.Members += o.Members
+	c.ActiveMembers += o.ActiveMembers
+	c.ReviewAssignments += o.ReviewAssignments
+	c.OpenPullRequests += o.OpenPullRequests
+	c.MergedPullRequests += o.MergedPullRequests
+}
+
+// TeamStats holds the team's own counters and the totals rolled up over all
+// of its subteams.
+type TeamStats struct {
+	TeamName string          `json:"team_name"`
+	Own      TeamStatsCounts `json:"own"`
+	Total    TeamStatsCounts `json:"total"`
+	Subteams []TeamStats     `json:"subteams,omitempty"`
+}
+
+// checkParent returns INVALID_HIERARCHY if making parent the parent of
+// teamName would create a cycle.
+func (s *Service) checkParent(ctx context.Context, teamName, parent string) error {
+	seen := make(map[string]struct{})
+	for t := parent; t != ""; {
+		if t == teamName {
+			return NewDomainError(model.ErrorCodeInvalidHierarchy,
+				"team "+parent+" is a subteam of "+teamName+" and cannot be its parent")
+		}
+		if _, ok := seen[t]; ok {
+			break
+		}
+		seen[t] = struct{}{}
+
+		var err error
+		if t, err = s.repo.GetTeamParent(ctx, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subtree returns the names of all teams below teamName, breadth first.
+func (s *Service) subtree(ctx context.Context, teamName string) ([]string, error) {
+	var res []string
+	seen := map[string]struct{}{teamName: {}}
+	queue := []string{teamName}
+	for len(queue) > 0 {
+		children, err := s.repo.GetSubteams(ctx, queue[0])
+		if err != nil {
+			return nil, err
+		}
+		queue = queue[1:]
+
+		for _, c := range children {
+			if _, ok := seen[c]; ok {
+				continue
+			}
+			seen[c] = struct{}{}
+			res = append(res, c)
+			queue = append(queue, c)
+		}
+	}
+	return res, nil
+}
+
+// hierarchyTeams lists the teams reviewer selection climbs to from teamName:
+// the parent with its other subteams, then the grandparent with its
+// subteams, and so on up to the top-level team.
+func (s *Service) hierarchyTeams(ctx context.Context, teamName string) ([]string, error) {
+	var res []string
+	seen := map[string]struct{}{teamName: {}}
+	for t := teamName; ; {
+		parent, err := s.repo.GetTeamParent(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[parent]; parent == "" || ok {
+			return res, nil
+		}
+
+		below, err := s.subtree(ctx, parent)
+		if err != nil {
+			return nil, err
+		}
+		for _, team := range append([]string{parent}, below...) {
+			if _, ok := seen[team]; ok {
+				continue
+			}
+			seen[team] = struct{}{}
+			res = append(res, team)
+		}
+		t = parent
+	}
+}
+
+// GetTeamTree returns the team with its subteams filled in recursively.
+func (s *Service) GetTeamTree(ctx context.Context, teamName string) (model.Team, error) {
+	team, err := s.GetTeam(ctx, teamName)
+	if err != nil {
+		return model.Team{}, err
+	}
+	return team, s.fillSubteams(ctx, &team, map[string]struct{}{teamName: {}})
+}
+
+func (s *Service) fillSubteams(ctx context.Context, team *model.Team, seen map[string]struct{}) error {
+	children, err := s.repo.GetSubteams(ctx, team.TeamName)
+	if err != nil {
+		return err
+	}
+	for _, name := range children {
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+
+		child, err := s.repo.GetTeam(ctx, name)
+		if err != nil {
+			return err
+		}
+		if err := s.fillSubteams(ctx, &child, seen); err != nil {
+			return err
+		}
+		team.Subteams = append(team.Subteams, child)
+	}
+	return nil
+}
+
+// GetTeamStats returns the stats of teamName, or of every top-level team if
+// teamName is empty, rolled up over the subteams.
+func (s *Service) GetTeamStats(ctx context.Context, teamName string) ([]TeamStats, error) {
+	roots := []string{teamName}
+	if teamName == "" {
+		var err error
+		if roots, err = s.repo.GetSubteams(ctx, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	reviewerStats, err := s.repo.GetReviewerStats(ctx, model.ReviewerStatsFilter{})
+	if err != nil {
+		return nil, err
+	}
+	assignments := make(map[string]int, len(reviewerStats))
+	for _, item := range reviewerStats {
+		assignments[item.UserID] = item.ReviewCount
+	}
+
+	res := make([]TeamStats, 0, len(roots))
+	seen := make(map[string]struct{})
+	for _, root := range roots {
+		st, err := s.teamStats(ctx, root, assignments, seen)
+		if err != nil {
+			if errors.Is(err, repository.ErrTeamNotFound) {
+				return nil, NewDomainError(model.ErrorCodeNotFound, "team not found")
+			}
+			return nil, err
+		}
+		res = append(res, st)
+	}
+	return res, nil
+}
+
+func (s *Service) teamStats(ctx context.Context, teamName string, assignments map[string]int, seen map[string]struct{}) (TeamStats, error) {
+	seen[teamName] = struct{}{}
+	st := TeamStats{TeamName: teamName}
+
+	team, err := s.repo.GetTeam(ctx, teamName)
+	if err != nil {
+		return st, err
+	}
+	for _, m := range team.Members {
+		st.Own.Members++
+		if m.IsActive {
+			st.Own.ActiveMembers++
+		}
+		st.Own.ReviewAssignments += assignments[m.UserID]
+	}
+
+	prs, err := s.repo.GetPRsByTeam(ctx, teamName)
+	if err != nil {
+		return st, err
+	}
+	for _, pr := range prs {
+		switch pr.Status {
+		case model.StatusOpen:
+			st.Own.OpenPullRequests++
+		case model.StatusMerged:
+			st.Own.MergedPullRequests++
+		}
+	}
+
+	st.Total = st.Own
+	children, err := s.repo.GetSubteams(ctx, teamName)
+	if err != nil {
+		return st, err
+	}
+	for _, name := range children {
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		child, err := s.teamStats(ctx, name, assignments, seen)
+		if err != nil {
+			return st, err
+		}
+		st.Total.add(child.Total)
+		st.Subteams = append(st.Subteams, child)
+	}
+	return st, nil
+}
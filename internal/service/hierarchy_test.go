@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+)
+
+// eng
+// ├── backend (a, b)
+// │   └── payments (p1)
+// └── frontend (f1)
+func addTestHierarchy(t *testing.T, svc *Service) {
+	t.Helper()
+	teams := []model.Team{
+		{TeamName: "eng", Members: []model.TeamMember{{UserID: "e1", Username: "e1", IsActive: true}}},
+		{TeamName: "backend", ParentTeam: "eng", Members: []model.TeamMember{
+			{UserID: "a", Username: "a", IsActive: true},
+			{UserID: "b", Username: "b", IsActive: true},
+		}},
+		{TeamName: "frontend", ParentTeam: "eng", Members: []model.TeamMember{{UserID: "f1", Username: "f1", IsActive: true}}},
+		{TeamName: "payments", ParentTeam: "backend", Members: []model.TeamMember{{UserID: "p1", Username: "p1", IsActive: true}}},
+	}
+	for _, team := range teams {
+		if _, err := svc.AddTeam(context.Background(), team); err != nil {
+			t.Fatalf("AddTeam(%s): %v", team.TeamName, err)
+		}
+	}
+}
+
+func TestHierarchyClimb(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	addTestHierarchy(t, svc)
+	three := 3
+	if _, err := svc.UpdateTeam(ctx, UpdateTeamInput{TeamName: "backend", ReviewerCount: &three}); err != nil {
+		t.Fatal(err)
+	}
+
+	pr, err := svc.CreatePR(ctx, CreatePRInput{ID: "p", Name: "p", AuthorID: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pr.AssignedReviewers, []string{"b"}) {
+		t.Fatalf("reviewers without climbing = %v, want [b]", pr.AssignedReviewers)
+	}
+
+	climb := true
+	if _, err := svc.UpdateTeam(ctx, UpdateTeamInput{TeamName: "backend", ClimbHierarchy: &climb}); err != nil {
+		t.Fatal(err)
+	}
+	// The parent comes first, then its other subteams; the team's own
+	// subteams come last.
+	pr, err = svc.CreatePR(ctx, CreatePRInput{ID: "q", Name: "q", AuthorID: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := make(map[string]string)
+	for _, rv := range pr.Reviews {
+		sources[rv.ReviewerID] = rv.SourceTeam
+	}
+	want := map[string]string{"b": "backend", "e1": "eng", "f1": "frontend"}
+	if !reflect.DeepEqual(sources, want) {
+		t.Fatalf("reviews = %+v, want %v", pr.Reviews, want)
+	}
+
+	parent := "payments"
+	_, err = svc.UpdateTeam(ctx, UpdateTeamInput{TeamName: "eng", ParentTeam: &parent})
+	wantCode(t, err, model.ErrorCodeInvalidHierarchy)
+}
+
+func TestHierarchyStats(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	addTestHierarchy(t, svc)
+	if _, err := svc.CreatePR(ctx, CreatePRInput{ID: "p", Name: "p", AuthorID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.CreatePR(ctx, CreatePRInput{ID: "q", Name: "q", AuthorID: "f1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.MergePR(ctx, "q", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := svc.GetTeamStats(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].TeamName != "eng" {
+		t.Fatalf("top-level stats = %+v", stats)
+	}
+	eng := stats[0]
+	if want := (TeamStatsCounts{Members: 1, ActiveMembers: 1}); eng.Own != want {
+		t.Fatalf("eng own = %+v, want %+v", eng.Own, want)
+	}
+	// p has the only backend reviewer b; q has none, f1 being alone.
+	if want := (TeamStatsCounts{Members: 5, ActiveMembers: 5, ReviewAssignments: 1, OpenPullRequests: 1, MergedPullRequests: 1}); eng.Total != want {
+		t.Fatalf("eng total = %+v, want %+v", eng.Total, want)
+	}
+
+	var names []string
+	for _, st := range eng.Subteams {
+		names = append(names, st.TeamName)
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"backend", "frontend"}) {
+		t.Fatalf("eng subteams = %v", names)
+	}
+
+	tree, err := svc.GetTeamTree(ctx, "eng")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sub := range tree.Subteams {
+		if sub.TeamName == "backend" && (len(sub.Subteams) != 1 || sub.Subteams[0].TeamName != "payments") {
+			t.Fatalf("backend subteams = %+v", sub.Subteams)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+	"github.com/Mavichy/AvitoNovember/internal/repository"
+)
+
+// prTransitions lists the allowed pull request status changes.
+// MERGED is final.
+var prTransitions = map[model.PullRequestStatus][]model.PullRequestStatus{
+	model.StatusDraft:  {model.StatusOpen, model.StatusClosed},
+	model.StatusOpen:   {model.StatusMerged, model.StatusClosed},
+	model.StatusClosed: {model.StatusOpen},
+}
+
+func checkTransition(from, to model.PullRequestStatus) error {
+	for _, allowed := range prTransitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return NewDomainError(model.ErrorCodeInvalidTransition,
+		"cannot change pull request status from "+string(from)+" to "+string(to))
+}
+
+// ClosePR abandons an OPEN or DRAFT pull request. Its reviewers stay
+// assigned but no longer count as open reviews.
+func (s *Service) ClosePR(ctx context.Context, prID string) (model.PullRequest, error) {
+	return s.transitionPR(ctx, prID, "close", model.StatusClosed, model.StatusOpen, model.StatusDraft)
+}
+
+// ReopenPR moves a CLOSED pull request back to OPEN and tops up its reviewers.
+func (s *Service) ReopenPR(ctx context.Context, prID string) (model.PullRequest, error) {
+	return s.transitionPR(ctx, prID, "reopen", model.StatusOpen, model.StatusClosed)
+}
+
+// MarkPRReady moves a DRAFT pull request to OPEN and assigns its reviewers.
+func (s *Service) MarkPRReady(ctx context.Context, prID string) (model.PullRequest, error) {
+	return s.transitionPR(ctx, prID, "mark ready", model.StatusOpen, model.StatusDraft)
+}
+
+// transitionPR performs action, changing the status of a pull request
+// currently in one of from to to.
+func (s *Service) transitionPR(ctx context.Context, prID, action string, to model.PullRequestStatus, from ...model.PullRequestStatus) (model.PullRequest, error) {
+	var pr model.PullRequest
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		var err error
+		pr, err = s.repo.LockPR(ctx, prID)
+		if err != nil {
+			return err
+		}
+
+		if !containsStatus(from, pr.Status) {
+			return NewDomainError(model.ErrorCodeInvalidTransition,
+				"cannot "+action+" "+string(pr.Status)+" pull request")
+		}
+		if err := checkTransition(pr.Status, to); err != nil {
+			return err
+		}
+		// An archived team takes no new work, so its PRs cannot go back to
+		// review, just as its members cannot open new ones.
+		if to == model.StatusOpen {
+			if err := s.checkAuthorTeamNotArchived(ctx, pr.AuthorID); err != nil {
+				return err
+			}
+		}
+
+		if err := s.repo.SetPRStatus(ctx, prID, to); err != nil {
+			return err
+		}
+
+		if to == model.StatusOpen {
+			if err := s.fillReviewers(ctx, pr); err != nil {
+				return err
+			}
+		}
+
+		pr, err = s.repo.GetPR(ctx, prID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrPRNotFound) {
+			return model.PullRequest{}, NewDomainError(model.ErrorCodeNotFound, "pull request not found")
+		}
+		return model.PullRequest{}, err
+	}
+	return pr, nil
+}
+
+func (s *Service) checkAuthorTeamNotArchived(ctx context.Context, authorID string) error {
+	author, err := s.repo.GetUser(ctx, authorID)
+	if err != nil {
+		return err
+	}
+	if author.TeamName == "" {
+		return nil
+	}
+	return s.checkTeamNotArchived(ctx, author.TeamName)
+}
+
+// fillReviewers assigns reviewers until the PR has as many as the author's
+// team requires. Must run in a transaction.
+func (s *Service) fillReviewers(ctx context.Context, pr model.PullRequest) error {
+	author, err := s.repo.GetUser(ctx, pr.AuthorID)
+	if err != nil {
+		return err
+	}
+	settings, err := s.teamSettings(ctx, author)
+	if err != nil {
+		return err
+	}
+
+	missing := settings.ReviewerCount - len(pr.AssignedReviewers)
+	if missing <= 0 {
+		return nil
+	}
+
+	// Topping up is best effort: when everyone is at capacity the PR keeps
+	// the reviewers it has. A missing required code owner is still an error.
+	picked, err := s.pickReviewers(ctx, author, pr, missing)
+	s.recordSelectionFailure(ctx, opFill, err)
+	if de, ok := AsDomainError(err); ok && de.Code == model.ErrorCodeNoCandidate {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(picked) == 0 {
+		return nil
+	}
+	if err := s.repo.AddReviewers(ctx, pr.ID, picked); err != nil {
+		return err
+	}
+	s.recordAssignments(ctx, opFill, len(picked))
+	return nil
+}
+
+func containsStatus(statuses []model.PullRequestStatus, st model.PullRequestStatus) bool {
+	for _, v := range statuses {
+		if v == st {
+			return true
+		}
+	}
+	return false
+}
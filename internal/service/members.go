@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+	"github.com/Mavichy/AvitoNovember/internal/repository"
+)
+
+// MembershipResult is the user after a membership change together with the
+// reviews that were handed over in their old team.
+type MembershipResult struct {
+	User    model.User       `json:"user"`
+	Changes []ReviewerChange `json:"changes"`
+}
+
+// AddTeamMembers adds users to an existing team. Users that already belong
+// to another team are rejected; they have to be moved with MoveUser.
+// Archived teams do not accept new members.
+func (s *Service) AddTeamMembers(ctx context.Context, teamName string, members []model.TeamMember) (model.Team, error) {
+	normalizeMemberTags(members)
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		if err := s.checkTeamNotArchived(ctx, teamName); err != nil {
+			return err
+		}
+		return s.repo.AddTeamMembers(ctx, teamName, members)
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrTeamNotFound) {
+			return model.Team{}, NewDomainError(model.ErrorCodeNotFound, "team not found")
+		}
+		if errors.Is(err, repository.ErrUserInOtherTeam) {
+			return model.Team{}, NewDomainError(model.ErrorCodeUserInOtherTeam, err.Error())
+		}
+		return model.Team{}, err
+	}
+	return s.repo.GetTeam(ctx, teamName)
+}
+
+// RemoveTeamMember takes the user out of teamName. Their open reviews are
+// handed over to other members the same way as on bulk deactivation.
+func (s *Service) RemoveTeamMember(ctx context.Context, teamName, userID string) (MembershipResult, error) {
+	return s.changeTeam(ctx, userID, teamName, "")
+}
+
+// MoveUser moves the user to another team, handing over their open reviews
+// in the old team.
+func (s *Service) MoveUser(ctx context.Context, userID, toTeam string) (MembershipResult, error) {
+	return s.changeTeam(ctx, userID, "", toTeam)
+}
+
+// changeTeam moves userID from fromTeam ("" for any) to toTeam ("" for no
+// team) in one transaction.
+func (s *Service) changeTeam(ctx context.Context, userID, fromTeam, toTeam string) (MembershipResult, error) {
+	var res MembershipResult
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		if err := s.lockReviewedPRs(ctx, []string{userID}); err != nil {
+			return err
+		}
+		locked, err := s.lockUsers(ctx, []string{userID})
+		if err != nil {
+			return err
+		}
+		user, ok := locked[userID]
+		if !ok {
+			return NewDomainError(model.ErrorCodeNotFound, "user "+userID+" not found")
+		}
+		if fromTeam != "" && user.TeamName != fromTeam {
+			return NewDomainError(model.ErrorCodeNotFound, "user "+userID+" does not belong to team "+fromTeam)
+		}
+		if toTeam != "" {
+			if err := s.checkTeamNotArchived(ctx, toTeam); err != nil {
+				return err
+			}
+		}
+
+		res.User = user
+		if user.TeamName == toTeam {
+			return nil
+		}
+
+		// Reviews are handed over before the move, so that replacements are
+		// picked from the old team.
+		prs, err := s.repo.GetPRsForReviewer(ctx, userID)
+		if err != nil {
+			return err
+		}
+		for _, prShort := range prs {
+			if prShort.Status != model.StatusOpen {
+				continue
+			}
+			change, changed, err := s.releaseReviewer(ctx, prShort.ID, userID)
+			if err != nil {
+				return err
+			}
+			if changed {
+				res.Changes = append(res.Changes, change)
+			}
+		}
+
+		res.User, err = s.repo.SetUserTeam(ctx, userID, toTeam)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrTeamNotFound) {
+			return MembershipResult{}, NewDomainError(model.ErrorCodeNotFound, "team not found")
+		}
+		return MembershipResult{}, err
+	}
+	return res, nil
+}
+
+func (s *Service) RenameUser(ctx context.Context, userID, username string) (model.User, error) {
+	u, err := s.repo.SetUsername(ctx, userID, username)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return model.User{}, NewDomainError(model.ErrorCodeNotFound, "user not found")
+		}
+		return model.User{}, err
+	}
+	return u, nil
+}
+
+// teamSettings returns the settings of the user's team. Users removed from
+// their team get the defaults, so that their pull requests can still be
+// reviewed and merged.
+func (s *Service) teamSettings(ctx context.Context, u model.User) (model.TeamSettings, error) {
+	if u.TeamName == "" {
+		return model.TeamSettings{ReviewerCount: defaultReviewerCount}, nil
+	}
+	return s.repo.GetTeamSettings(ctx, u.TeamName)
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+)
+
+// A reviewer left without a team is replaced from the author's team, and
+// dropped when that team has nobody left.
+func TestTeamlessReviewerIsReplacedFromAuthorTeam(t *testing.T) {
+	ctx := context.Background()
+	svc, repo := newTestService(t)
+	addTestTeam(t, svc, "backend", "a", "b", "c")
+	addTestTeam(t, svc, "frontend", "f")
+
+	if _, err := svc.CreatePR(ctx, CreatePRInput{ID: "p", Name: "p", AuthorID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	// Reviews held by users without a team can exist in older data.
+	for _, id := range []string{"b", "c"} {
+		if _, err := repo.SetUserTeam(ctx, id, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := svc.AddTeamMembers(ctx, "backend", []model.TeamMember{{UserID: "d", Username: "d", IsActive: true}}); err != nil {
+		t.Fatal(err)
+	}
+
+	rr, err := svc.ReassignReviewer(ctx, "p", "b")
+	if err != nil {
+		t.Fatalf("reassign: %v", err)
+	}
+	if rr.ReplacedBy != "d" {
+		t.Fatalf("replaced by %q, want d", rr.ReplacedBy)
+	}
+
+	res, err := svc.MoveUser(ctx, "c", "frontend")
+	if err != nil {
+		t.Fatalf("move: %v", err)
+	}
+	want := ReviewerChange{PullRequestID: "p", OldReviewerID: "c"}
+	if len(res.Changes) != 1 || res.Changes[0] != want {
+		t.Fatalf("move changes = %+v, want %+v", res.Changes, want)
+	}
+}
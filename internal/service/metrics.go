@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+
+	"github.com/Mavichy/AvitoNovember/internal/logging"
+	"github.com/Mavichy/AvitoNovember/internal/metrics"
+	"github.com/Mavichy/AvitoNovember/internal/model"
+)
+
+// Operations reviewer assignments are counted under.
+const (
+	opCreate   = "create"
+	opReassign = "reassign"
+	opFill     = "fill"
+	opRelease  = "release"
+)
+
+type serviceMetrics struct {
+	assignments *metrics.CounterVec
+	failures    *metrics.CounterVec
+}
+
+// WithMetrics counts reviewer assignments and selection failures in reg.
+func WithMetrics(reg *metrics.Registry) Option {
+	return func(s *Service) {
+		s.metrics = serviceMetrics{
+			assignments: reg.NewCounterVec("reviewer_assignments_total",
+				"Reviewers assigned by operation.", "operation"),
+			failures: reg.NewCounterVec("reviewer_selection_failures_total",
+				"Reviewer selections that found no candidate, by operation and error code.", "operation", "code"),
+		}
+	}
+}
+
+type noMetricsKey struct{}
+
+// withoutMetrics marks ctx so that nothing is counted, e.g. for dry runs
+// whose changes are rolled back.
+func withoutMetrics(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noMetricsKey{}, true)
+}
+
+type pendingMetricsKey struct{}
+
+// pendingMetrics holds what a transaction counted until it is over.
+type pendingMetrics struct {
+	assignments map[string]int
+	failures    []pendingFailure
+}
+
+type pendingFailure struct {
+	op  string
+	err *DomainError
+}
+
+// inTx runs fn in a transaction and records the metrics it counted once the
+// transaction is over: assignments only if it committed, selection failures
+// in any case, since they are often what rolled it back.
+func (s *Service) inTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(pendingMetricsKey{}).(*pendingMetrics); ok {
+		return s.repo.InTx(ctx, fn)
+	}
+
+	p := &pendingMetrics{assignments: make(map[string]int)}
+	err := s.repo.InTx(context.WithValue(ctx, pendingMetricsKey{}, p), fn)
+	for _, f := range p.failures {
+		s.countSelectionFailure(ctx, f.op, f.err)
+	}
+	if err == nil {
+		for op, n := range p.assignments {
+			s.metrics.assignments.Add(float64(n), op)
+		}
+	}
+	return err
+}
+
+func (s *Service) recordAssignments(ctx context.Context, op string, n int) {
+	if n <= 0 || ctx.Value(noMetricsKey{}) != nil {
+		return
+	}
+	if p, ok := ctx.Value(pendingMetricsKey{}).(*pendingMetrics); ok {
+		p.assignments[op] += n
+		return
+	}
+	s.metrics.assignments.Add(float64(n), op)
+}
+
+// recordSelectionFailure counts and logs err if it means no reviewer could be
+// picked.
+func (s *Service) recordSelectionFailure(ctx context.Context, op string, err error) {
+	if ctx.Value(noMetricsKey{}) != nil {
+		return
+	}
+	de, ok := AsDomainError(err)
+	if !ok || (de.Code != model.ErrorCodeNoCandidate && de.Code != model.ErrorCodeNoCodeOwner) {
+		return
+	}
+	if p, ok := ctx.Value(pendingMetricsKey{}).(*pendingMetrics); ok {
+		p.failures = append(p.failures, pendingFailure{op: op, err: de})
+		return
+	}
+	s.countSelectionFailure(ctx, op, de)
+}
+
+func (s *Service) countSelectionFailure(ctx context.Context, op string, de *DomainError) {
+	s.metrics.failures.Inc(op, string(de.Code))
+	logging.FromContext(ctx).WarnContext(ctx, "no reviewer selected",
+		"operation", op, "code", de.Code, "reason", de.Message)
+}
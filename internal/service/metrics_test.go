@@ -0,0 +1,98 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Mavichy/AvitoNovember/internal/metrics"
+	"github.com/Mavichy/AvitoNovember/internal/model"
+	"github.com/Mavichy/AvitoNovember/internal/repository"
+)
+
+var errCommit = errors.New("commit failed")
+
+// commitFailingStore runs transactions but reports a failed commit while
+// fail is set, discarding their changes.
+type commitFailingStore struct {
+	*repository.MemoryRepository
+	fail bool
+}
+
+func (s *commitFailingStore) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	fail := s.fail
+	return s.MemoryRepository.InTx(ctx, func(ctx context.Context) error {
+		if err := fn(ctx); err != nil {
+			return err
+		}
+		if fail {
+			return errCommit
+		}
+		return nil
+	})
+}
+
+func metricLines(t *testing.T, reg *metrics.Registry, prefix string) []string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := reg.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var res []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			res = append(res, line)
+		}
+	}
+	return res
+}
+
+func TestAssignmentMetricsCountCommittedWork(t *testing.T) {
+	ctx := context.Background()
+	store := &commitFailingStore{MemoryRepository: repository.NewMemoryRepository()}
+	selectors, err := NewSelectors(StrategyRoundRobin, nil, nil, NewRand(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := metrics.NewRegistry()
+	svc := NewService(store, WithSelectors(selectors), WithMetrics(reg))
+	addTestTeam(t, svc, "backend", "a", "b", "c", "d")
+
+	if _, err := svc.CreatePR(ctx, CreatePRInput{ID: "p", Name: "p", AuthorID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.CreatePR(ctx, CreatePRInput{ID: "draft", Name: "draft", AuthorID: "a", Draft: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rolled back work is not counted.
+	store.fail = true
+	if _, err := svc.ReassignReviewer(ctx, "p", "b"); !errors.Is(err, errCommit) {
+		t.Fatalf("reassign: got %v, want the commit error", err)
+	}
+	if _, err := svc.MarkPRReady(ctx, "draft"); !errors.Is(err, errCommit) {
+		t.Fatalf("markReady: got %v, want the commit error", err)
+	}
+	if _, err := svc.DeactivateTeamUsersAndReassign(ctx, "backend", []string{"b"}, true); err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	store.fail = false
+
+	// b and c review p; with d out of the way nobody can replace c.
+	if _, err := svc.SetUserIsActive(ctx, "d", false); err != nil {
+		t.Fatal(err)
+	}
+	_, err = svc.ReassignReviewer(ctx, "p", "c")
+	wantCode(t, err, model.ErrorCodeNoCandidate)
+
+	got := metricLines(t, reg, "reviewer_")
+	want := []string{
+		`reviewer_assignments_total{operation="create"} 2`,
+		`reviewer_selection_failures_total{operation="reassign",code="NO_CANDIDATE"} 1`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("metrics:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+)
+
+// GetPairingMatrix counts how often each member of the team reviewed each
+// other member's pull requests within window; window 0 counts all history.
+// Every member has a row and a column; reviewers from other teams (fallbacks,
+// code owners) get extra columns in the rows where they appear.
+func (s *Service) GetPairingMatrix(ctx context.Context, teamName string, window time.Duration) (model.PairingMatrix, error) {
+	team, err := s.GetTeam(ctx, teamName)
+	if err != nil {
+		return model.PairingMatrix{}, err
+	}
+
+	res := model.PairingMatrix{
+		TeamName: teamName,
+		Members:  []string{},
+		Matrix:   make(map[string]map[string]int, len(team.Members)),
+	}
+	if window > 0 {
+		since := time.Now().UTC().Add(-window)
+		res.Since = &since
+	}
+
+	for _, author := range team.Members {
+		res.Members = append(res.Members, author.UserID)
+		row := make(map[string]int, len(team.Members))
+		for _, reviewer := range team.Members {
+			if reviewer.UserID != author.UserID {
+				row[reviewer.UserID] = 0
+			}
+		}
+		res.Matrix[author.UserID] = row
+	}
+
+	pairs, err := s.repo.GetTeamPairings(ctx, teamName, res.Since)
+	if err != nil {
+		return model.PairingMatrix{}, err
+	}
+	for _, pc := range pairs {
+		if row, ok := res.Matrix[pc.AuthorID]; ok {
+			row[pc.ReviewerID] += pc.Count
+		}
+	}
+	return res, nil
+}
+
+// PairWindow is the configured pair avoidance window, 0 if it is off.
+func (s *Service) PairWindow() time.Duration {
+	return s.pairWindow
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mavichy/AvitoNovember/internal/repository"
+)
+
+func TestPairAvoidanceSpreadsReviews(t *testing.T) {
+	ctx := context.Background()
+	selectors, err := NewSelectors(StrategyRandom, nil, nil, NewRand(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewService(repository.NewMemoryRepository(), WithSelectors(selectors), WithPairAvoidance(time.Hour))
+	addTestTeam(t, svc, "backend", "a", "b", "c", "d")
+	one := 1
+	if _, err := svc.UpdateTeam(ctx, UpdateTeamInput{TeamName: "backend", ReviewerCount: &one}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each PR is merged, so load does not spread the reviews by itself.
+	seen := make(map[string]bool)
+	for _, id := range []string{"pr-1", "pr-2", "pr-3"} {
+		pr, err := svc.CreatePR(ctx, CreatePRInput{ID: id, Name: id, AuthorID: "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pr.AssignedReviewers) != 1 || seen[pr.AssignedReviewers[0]] {
+			t.Fatalf("%s reviewers = %v, already seen %v", id, pr.AssignedReviewers, seen)
+		}
+		seen[pr.AssignedReviewers[0]] = true
+		if _, err := svc.MergePR(ctx, id, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := svc.GetPairingMatrix(ctx, "backend", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []string{"b", "c", "d"} {
+		if got := m.Matrix["a"][r]; got != 1 {
+			t.Errorf("matrix[a][%s] = %d, want 1", r, got)
+		}
+	}
+}
+
+func TestPairAvoidanceOffByDefault(t *testing.T) {
+	svc, _ := newTestService(t)
+	if w := svc.PairWindow(); w != 0 {
+		t.Fatalf("PairWindow() = %v, want 0", w)
+	}
+}
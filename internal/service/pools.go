@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+	"github.com/Mavichy/AvitoNovember/internal/repository"
+)
+
+// reviewerPool is a team whose active members may be picked as reviewers.
+type reviewerPool struct {
+	team    string
+	userIDs []string
+}
+
+// reviewerPools returns homeTeam followed by its fallback teams and, if the
+// team climbs the hierarchy, by its ancestors and their subteams. Each pool
+// holds the team's active members except exclude. Archived teams other than
+// homeTeam are skipped. Users without a team have no pools.
+func (s *Service) reviewerPools(ctx context.Context, homeTeam string, exclude []string) ([]reviewerPool, error) {
+	teams, err := s.poolTeams(ctx, homeTeam)
+	if err != nil {
+		return nil, err
+	}
+
+	var pools []reviewerPool
+	for i, team := range teams {
+		if i > 0 {
+			archived, err := s.repo.IsTeamArchived(ctx, team)
+			if err != nil {
+				return nil, err
+			}
+			if archived {
+				continue
+			}
+		}
+
+		users, err := s.repo.GetActiveUsersByTeam(ctx, team)
+		if err != nil {
+			if errors.Is(err, repository.ErrTeamNotFound) {
+				return nil, NewDomainError(model.ErrorCodeNotFound, "team not found")
+			}
+			return nil, err
+		}
+
+		pool := reviewerPool{team: team}
+		for _, u := range users {
+			if !contains(exclude, u.UserID) {
+				pool.userIDs = append(pool.userIDs, u.UserID)
+			}
+		}
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+func (s *Service) poolTeams(ctx context.Context, homeTeam string) ([]string, error) {
+	if homeTeam == "" {
+		return nil, nil
+	}
+	settings, err := s.repo.GetTeamSettings(ctx, homeTeam)
+	if err != nil {
+		if errors.Is(err, repository.ErrTeamNotFound) {
+			return nil, NewDomainError(model.ErrorCodeNotFound, "team not found")
+		}
+		return nil, err
+	}
+
+	fallbacks, err := s.repo.GetTeamFallbacks(ctx, homeTeam)
+	if err != nil {
+		return nil, err
+	}
+	teams := append([]string{homeTeam}, fallbacks...)
+
+	if settings.ClimbHierarchy {
+		above, err := s.hierarchyTeams(ctx, homeTeam)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range above {
+			if !contains(teams, t) {
+				teams = append(teams, t)
+			}
+		}
+	}
+	return teams, nil
+}
+
+func poolUserIDs(pools []reviewerPool) []string {
+	var ids []string
+	for _, p := range pools {
+		ids = append(ids, p.userIDs...)
+	}
+	return ids
+}
+
+// selectFromPools picks up to count reviewers, taking from the next pool only
+// when the previous ones run short. Each review records the pool it came
+// from. locked must hold the rows of all pool members. NO_CANDIDATE is
+// returned only if nobody was picked because everyone was at capacity.
+func (s *Service) selectFromPools(ctx context.Context, authorID string, pools []reviewerPool, locked map[string]model.User, count int) ([]model.Review, error) {
+	var (
+		res         []model.Review
+		capacityErr error
+	)
+	for _, p := range pools {
+		if len(res) >= count {
+			break
+		}
+
+		ids := stillActiveIn(locked, p.team, p.userIDs)
+		picked, err := s.selectReviewers(ctx, p.team, authorID, locked, ids, count-len(res))
+		if de, ok := AsDomainError(err); ok && de.Code == model.ErrorCodeNoCandidate {
+			capacityErr = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range picked {
+			res = append(res, model.Review{ReviewerID: id, SourceTeam: p.team})
+		}
+	}
+
+	if len(res) == 0 && capacityErr != nil {
+		if len(pools) > 1 {
+			return nil, NewDomainError(model.ErrorCodeNoCandidate,
+				"all candidates in team "+pools[0].team+" and its fallback teams are at their review capacity")
+		}
+		return nil, capacityErr
+	}
+	return res, nil
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+	"github.com/Mavichy/AvitoNovember/internal/repository"
+)
+
+// defaultPRStatsWindow is the period /stats/pullRequests covers when no
+// start is given.
+const defaultPRStatsWindow = 30 * 24 * time.Hour
+
+// MaxPRStatsWindow is the longest period /stats/pullRequests reports on;
+// per_day holds an entry for every day of it.
+const MaxPRStatsWindow = 366 * 24 * time.Hour
+
+// Percentiles of a duration in hours, nearest-rank.
+type Percentiles struct {
+	Count int     `json:"count"`
+	P50   float64 `json:"p50_hours"`
+	P90   float64 `json:"p90_hours"`
+	P99   float64 `json:"p99_hours"`
+}
+
+// AgingBuckets count open pull requests by age.
+type AgingBuckets struct {
+	Under1d int `json:"under_1d"`
+	From1d  int `json:"from_1d_to_3d"`
+	From3d  int `json:"from_3d_to_7d"`
+	Over7d  int `json:"over_7d"`
+}
+
+// OpenAging describes the pull requests that are OPEN right now.
+type OpenAging struct {
+	Count       int          `json:"count"`
+	OldestHours float64      `json:"oldest_hours"`
+	Age         Percentiles  `json:"age"`
+	Buckets     AgingBuckets `json:"buckets"`
+}
+
+// PRStatsCounts are the latency and throughput figures of a group of PRs.
+// Opened and Merged count PRs created and merged within the period.
+type PRStatsCounts struct {
+	TeamName    string      `json:"team_name,omitempty"`
+	AuthorID    string      `json:"author_id,omitempty"`
+	Opened      int         `json:"opened"`
+	Merged      int         `json:"merged"`
+	TimeToMerge Percentiles `json:"time_to_merge"`
+	OpenAging   OpenAging   `json:"open_aging"`
+}
+
+type DayCounts struct {
+	Date   string `json:"date"`
+	Opened int    `json:"opened"`
+	Merged int    `json:"merged"`
+}
+
+// PRStats is the /stats/pullRequests report. PerDay covers every UTC day of
+// the period, including days without activity.
+type PRStats struct {
+	From     time.Time       `json:"from"`
+	To       time.Time       `json:"to"`
+	Total    PRStatsCounts   `json:"total"`
+	PerDay   []DayCounts     `json:"per_day"`
+	ByTeam   []PRStatsCounts `json:"by_team"`
+	ByAuthor []PRStatsCounts `json:"by_author"`
+}
+
+// GetPRStats reports time to merge and throughput for pull requests created
+// or merged in [from, to), and the aging of the ones open now. A nil to means
+// now, a nil from means 30 days before to. teamName limits the report to
+// pull requests of the team's current members.
+func (s *Service) GetPRStats(ctx context.Context, from, to *time.Time, teamName string) (PRStats, error) {
+	now := time.Now().UTC()
+	res := PRStats{To: now}
+	if to != nil {
+		res.To = to.UTC()
+	}
+	res.From = res.To.Add(-defaultPRStatsWindow)
+	if from != nil {
+		res.From = from.UTC()
+	}
+
+	if teamName != "" {
+		if _, err := s.repo.GetTeamSettings(ctx, teamName); err != nil {
+			if errors.Is(err, repository.ErrTeamNotFound) {
+				return PRStats{}, NewDomainError(model.ErrorCodeNotFound, "team not found")
+			}
+			return PRStats{}, err
+		}
+	}
+
+	prs, err := s.repo.GetPRTimes(ctx, teamName, res.From)
+	if err != nil {
+		return PRStats{}, err
+	}
+
+	in := func(t time.Time) bool { return !t.Before(res.From) && t.Before(res.To) }
+
+	var (
+		all      prGroup
+		byTeam   = make(map[string]*prGroup)
+		byAuthor = make(map[string]*prGroup)
+		perDay   = make(map[string]*DayCounts)
+	)
+	for d := truncateDay(res.From); d.Before(res.To); d = d.AddDate(0, 0, 1) {
+		key := d.Format(time.DateOnly)
+		perDay[key] = &DayCounts{Date: key}
+		res.PerDay = append(res.PerDay, DayCounts{Date: key})
+	}
+
+	for _, pr := range prs {
+		groups := []*prGroup{&all, groupFor(byAuthor, pr.AuthorID, prGroup{teamName: pr.TeamName, authorID: pr.AuthorID})}
+		if pr.TeamName != "" {
+			groups = append(groups, groupFor(byTeam, pr.TeamName, prGroup{teamName: pr.TeamName}))
+		}
+
+		if in(pr.CreatedAt) {
+			perDay[pr.CreatedAt.UTC().Format(time.DateOnly)].Opened++
+		}
+		if pr.MergedAt != nil && in(*pr.MergedAt) {
+			perDay[pr.MergedAt.UTC().Format(time.DateOnly)].Merged++
+		}
+
+		for _, g := range groups {
+			if in(pr.CreatedAt) {
+				g.opened++
+			}
+			if pr.MergedAt != nil && in(*pr.MergedAt) {
+				g.toMerge = append(g.toMerge, pr.MergedAt.Sub(pr.CreatedAt))
+			}
+			if pr.Status == model.StatusOpen {
+				g.ages = append(g.ages, now.Sub(pr.CreatedAt))
+			}
+		}
+	}
+
+	for i := range res.PerDay {
+		res.PerDay[i] = *perDay[res.PerDay[i].Date]
+	}
+	res.Total = all.counts()
+	res.ByTeam = groupCounts(byTeam)
+	res.ByAuthor = groupCounts(byAuthor)
+	return res, nil
+}
+
+type prGroup struct {
+	teamName string
+	authorID string
+	opened   int
+	toMerge  []time.Duration
+	ages     []time.Duration
+}
+
+func groupFor(groups map[string]*prGroup, key string, init prGroup) *prGroup {
+	g, ok := groups[key]
+	if !ok {
+		g = &init
+		groups[key] = g
+	}
+	return g
+}
+
+func (g *prGroup) counts() PRStatsCounts {
+	c := PRStatsCounts{
+		TeamName:    g.teamName,
+		AuthorID:    g.authorID,
+		Opened:      g.opened,
+		Merged:      len(g.toMerge),
+		TimeToMerge: percentiles(g.toMerge),
+		OpenAging: OpenAging{
+			Count: len(g.ages),
+			Age:   percentiles(g.ages),
+		},
+	}
+	for _, age := range g.ages {
+		c.OpenAging.OldestHours = math.Max(c.OpenAging.OldestHours, hours(age))
+		switch {
+		case age < 24*time.Hour:
+			c.OpenAging.Buckets.Under1d++
+		case age < 3*24*time.Hour:
+			c.OpenAging.Buckets.From1d++
+		case age < 7*24*time.Hour:
+			c.OpenAging.Buckets.From3d++
+		default:
+			c.OpenAging.Buckets.Over7d++
+		}
+	}
+	return c
+}
+
+// groupCounts returns the counts of the groups ordered by key.
+func groupCounts(groups map[string]*prGroup) []PRStatsCounts {
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	res := make([]PRStatsCounts, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, groups[k].counts())
+	}
+	return res
+}
+
+func percentiles(ds []time.Duration) Percentiles {
+	p := Percentiles{Count: len(ds)}
+	if len(ds) == 0 {
+		return p
+	}
+	sorted := append([]time.Duration(nil), ds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := func(q float64) float64 {
+		i := int(math.Ceil(q*float64(len(sorted)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return hours(sorted[i])
+	}
+	p.P50, p.P90, p.P99 = rank(0.5), rank(0.9), rank(0.99)
+	return p
+}
+
+// hours converts d to hours rounded to hundredths.
+func hours(d time.Duration) float64 {
+	return round2(d.Hours())
+}
+
+func truncateDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
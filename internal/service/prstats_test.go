@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPercentiles(t *testing.T) {
+	hoursOf := func(hs ...float64) []time.Duration {
+		var ds []time.Duration
+		for _, h := range hs {
+			ds = append(ds, time.Duration(h*float64(time.Hour)))
+		}
+		return ds
+	}
+
+	tests := []struct {
+		name string
+		in   []time.Duration
+		want Percentiles
+	}{
+		{"empty", nil, Percentiles{}},
+		{"single sample", hoursOf(3.5), Percentiles{Count: 1, P50: 3.5, P90: 3.5, P99: 3.5}},
+		{"two samples", hoursOf(4, 2), Percentiles{Count: 2, P50: 2, P90: 4, P99: 4}},
+		// Nearest rank: p50 is the 5th of 10 sorted values, p90 the 9th.
+		{"ten samples", hoursOf(10, 9, 8, 7, 6, 5, 4, 3, 2, 1), Percentiles{Count: 10, P50: 5, P90: 9, P99: 10}},
+		{"rounded", []time.Duration{20 * time.Minute}, Percentiles{Count: 1, P50: 0.33, P90: 0.33, P99: 0.33}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentiles(tt.in); got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPRGroupCounts(t *testing.T) {
+	g := prGroup{
+		teamName: "backend",
+		opened:   3,
+		toMerge:  []time.Duration{2 * time.Hour},
+		ages: []time.Duration{
+			time.Hour,
+			30 * time.Hour,
+			4 * 24 * time.Hour,
+			10 * 24 * time.Hour,
+			24 * time.Hour,
+		},
+	}
+	c := g.counts()
+
+	if c.TeamName != "backend" || c.Opened != 3 || c.Merged != 1 {
+		t.Fatalf("counts = %+v", c)
+	}
+	if c.TimeToMerge != (Percentiles{Count: 1, P50: 2, P90: 2, P99: 2}) {
+		t.Fatalf("time to merge = %+v", c.TimeToMerge)
+	}
+	wantBuckets := AgingBuckets{Under1d: 1, From1d: 2, From3d: 1, Over7d: 1}
+	if c.OpenAging.Count != 5 || c.OpenAging.Buckets != wantBuckets || c.OpenAging.OldestHours != 240 {
+		t.Fatalf("open aging = %+v", c.OpenAging)
+	}
+}
+
+func TestGetPRStats(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	addTestTeam(t, svc, "backend", "u1", "u2", "u3")
+	addTestTeam(t, svc, "frontend", "f1", "f2")
+
+	for _, id := range []string{"pr-1", "pr-2"} {
+		if _, err := svc.CreatePR(ctx, CreatePRInput{ID: id, Name: id, AuthorID: "u1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := svc.CreatePR(ctx, CreatePRInput{ID: "pr-3", Name: "pr-3", AuthorID: "u2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.MergePR(ctx, "pr-1", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	from := truncateDay(now).AddDate(0, 0, -2)
+	to := now.Add(time.Hour)
+
+	t.Run("throughput", func(t *testing.T) {
+		st, err := svc.GetPRStats(ctx, &from, &to, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Total.Opened != 3 || st.Total.Merged != 1 || st.Total.OpenAging.Count != 2 {
+			t.Fatalf("total = %+v", st.Total)
+		}
+		if st.Total.TimeToMerge.Count != 1 {
+			t.Fatalf("time to merge = %+v", st.Total.TimeToMerge)
+		}
+
+		// Two empty days before today, today, and tomorrow if to crosses midnight.
+		if n := len(st.PerDay); n < 3 || n > 4 {
+			t.Fatalf("per_day has %d entries", n)
+		}
+		for _, d := range st.PerDay[:2] {
+			if d.Opened != 0 || d.Merged != 0 {
+				t.Fatalf("day %s = %+v, want no activity", d.Date, d)
+			}
+		}
+		today := st.PerDay[2]
+		if today.Date != now.Format(time.DateOnly) || today.Opened != 3 || today.Merged != 1 {
+			t.Fatalf("today = %+v", today)
+		}
+
+		if len(st.ByAuthor) != 2 || st.ByAuthor[0].AuthorID != "u1" || st.ByAuthor[0].Opened != 2 || st.ByAuthor[0].Merged != 1 {
+			t.Fatalf("by author = %+v", st.ByAuthor)
+		}
+		if len(st.ByTeam) != 1 || st.ByTeam[0].TeamName != "backend" || st.ByTeam[0].Opened != 3 {
+			t.Fatalf("by team = %+v", st.ByTeam)
+		}
+	})
+
+	t.Run("empty range", func(t *testing.T) {
+		old := from.AddDate(0, 0, -10)
+		st, err := svc.GetPRStats(ctx, &old, &from, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Total.Opened != 0 || st.Total.Merged != 0 || st.Total.TimeToMerge != (Percentiles{}) {
+			t.Fatalf("total = %+v", st.Total)
+		}
+		if len(st.PerDay) != 10 {
+			t.Fatalf("per_day has %d entries, want 10", len(st.PerDay))
+		}
+	})
+
+	t.Run("team without pull requests", func(t *testing.T) {
+		st, err := svc.GetPRStats(ctx, &from, &to, "frontend")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Total.Opened != 0 || len(st.ByAuthor) != 0 || len(st.ByTeam) != 0 {
+			t.Fatalf("stats = %+v", st)
+		}
+	})
+}
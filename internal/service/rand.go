@@ -0,0 +1,34 @@
+package service
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Rand is the source of randomness used by reviewer selectors.
+// Implementations must be safe for concurrent use.
+type Rand interface {
+	Intn(n int) int
+}
+
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+// NewRand returns a goroutine-safe Rand seeded with seed. The same seed
+// always yields the same sequence, which makes assignments reproducible.
+func NewRand(seed int64) Rand {
+	return &lockedRand{r: rand.New(rand.NewSource(seed))}
+}
+
+func newTimeSeededRand() Rand {
+	return NewRand(time.Now().UnixNano())
+}
+
+func (l *lockedRand) Intn(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Intn(n)
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+)
+
+// A required code owner without a replacement is dropped when released
+// instead of failing deactivation, team moves and absences.
+func TestReleaseRequiredOwnerWithoutReplacement(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	addTestTeam(t, svc, "backend", "u1", "u2", "u3")
+	addTestTeam(t, svc, "frontend", "f1")
+	if _, err := svc.SetCodeOwners(ctx, "backend", model.CodeOwners{
+		Rules: "/payments/ @u2 @u3",
+		Mode:  model.CodeOwnersRequire,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"pr-1", "pr-2", "pr-3"} {
+		pr, err := svc.CreatePR(ctx, CreatePRInput{ID: id, Name: id, AuthorID: "u1", ChangedFiles: []string{"payments/api.go"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pr.AssignedReviewers) != 2 {
+			t.Fatalf("%s reviewers = %v", id, pr.AssignedReviewers)
+		}
+	}
+
+	res, err := svc.DeactivateTeamUsersAndReassign(ctx, "backend", []string{"u2"}, false)
+	if err != nil {
+		t.Fatalf("deactivate: %v", err)
+	}
+	if res.RemovedReviewers != 3 || res.ReassignedReviewers != 0 {
+		t.Fatalf("deactivate result = %+v", res)
+	}
+
+	moved, err := svc.MoveUser(ctx, "u3", "frontend")
+	if err != nil {
+		t.Fatalf("move: %v", err)
+	}
+	if len(moved.Changes) != 3 {
+		t.Fatalf("move changes = %+v", moved.Changes)
+	}
+
+	if _, err := svc.SetUserIsActive(ctx, "u2", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SetUserIsActive(ctx, "u3", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.CreatePR(ctx, CreatePRInput{ID: "pr-4", Name: "pr-4", AuthorID: "u1", ChangedFiles: []string{"payments/api.go"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := svc.SetUserAbsences(ctx, "u2", []model.Absence{{
+		StartsAt: time.Now().Add(-time.Hour),
+		EndsAt:   time.Now().Add(time.Hour),
+	}})
+	if err != nil {
+		t.Fatalf("set absence: %v", err)
+	}
+	if len(changes) != 1 || changes[0].PullRequestID != "pr-4" || changes[0].NewReviewerID != "" {
+		t.Fatalf("absence changes = %+v", changes)
+	}
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	StrategyRandom      = "random"
+	StrategyRoundRobin  = "round-robin"
+	StrategyLeastLoaded = "least-loaded"
+	StrategyWeighted    = "weighted"
+)
+
+// Candidate is an active user that may be assigned as a reviewer.
+type Candidate struct {
+	UserID string
+	// Load is the number of OPEN pull requests the user currently reviews.
+	Load int
+	// RecentPairings is how many times the user was assigned to review the
+	// PR author's pull requests within the pair avoidance window.
+	RecentPairings int
+}
+
+type SelectRequest struct {
+	TeamName   string
+	Candidates []Candidate
+	Count      int
+}
+
+// ReviewerSelector picks up to req.Count distinct reviewers from req.Candidates.
+type ReviewerSelector interface {
+	Select(req SelectRequest) []string
+}
+
+// Selectors maps teams to their reviewer selection strategy.
+type Selectors struct {
+	Default ReviewerSelector
+	ByTeam  map[string]ReviewerSelector
+}
+
+func (s Selectors) For(teamName string) ReviewerSelector {
+	if sel, ok := s.ByTeam[teamName]; ok {
+		return sel
+	}
+	return s.Default
+}
+
+// NewSelectors builds the default selector and per-team overrides from strategy names.
+func NewSelectors(defaultStrategy string, teamStrategies map[string]string, weights map[string]int, rnd Rand) (Selectors, error) {
+	def, err := NewSelector(defaultStrategy, weights, rnd)
+	if err != nil {
+		return Selectors{}, err
+	}
+
+	byTeam := make(map[string]ReviewerSelector, len(teamStrategies))
+	for team, strategy := range teamStrategies {
+		sel, err := NewSelector(strategy, weights, rnd)
+		if err != nil {
+			return Selectors{}, fmt.Errorf("team %s: %w", team, err)
+		}
+		byTeam[team] = sel
+	}
+
+	return Selectors{Default: def, ByTeam: byTeam}, nil
+}
+
+func NewSelector(strategy string, weights map[string]int, rnd Rand) (ReviewerSelector, error) {
+	switch strategy {
+	case "", StrategyRandom:
+		return &RandomSelector{rand: rnd}, nil
+	case StrategyRoundRobin:
+		return NewRoundRobinSelector(), nil
+	case StrategyLeastLoaded:
+		return &LeastLoadedSelector{rand: rnd}, nil
+	case StrategyWeighted:
+		return &WeightedSelector{rand: rnd, weights: weights}, nil
+	default:
+		return nil, fmt.Errorf("unknown reviewer strategy %q", strategy)
+	}
+}
+
+func limit(ids []string, n int) []string {
+	if n < 0 {
+		n = 0
+	}
+	if len(ids) > n {
+		return ids[:n]
+	}
+	return ids
+}
+
+// RandomSelector shuffles the candidates and takes the first Count of them.
+type RandomSelector struct {
+	rand Rand
+}
+
+func (s *RandomSelector) Select(req SelectRequest) []string {
+	ids := make([]string, 0, len(req.Candidates))
+	for _, c := range req.Candidates {
+		ids = append(ids, c.UserID)
+	}
+
+	for i := range ids {
+		j := s.rand.Intn(i + 1)
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+	return limit(ids, req.Count)
+}
+
+// RoundRobinSelector walks the team members in user_id order, continuing
+// after the last reviewer it picked for the team.
+type RoundRobinSelector struct {
+	mu   sync.Mutex
+	last map[string]string
+}
+
+func NewRoundRobinSelector() *RoundRobinSelector {
+	return &RoundRobinSelector{last: make(map[string]string)}
+}
+
+func (s *RoundRobinSelector) Select(req SelectRequest) []string {
+	if len(req.Candidates) == 0 || req.Count <= 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(req.Candidates))
+	for _, c := range req.Candidates {
+		ids = append(ids, c.UserID)
+	}
+	sort.Strings(ids)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := sort.SearchStrings(ids, s.last[req.TeamName])
+	if start < len(ids) && ids[start] == s.last[req.TeamName] {
+		start++
+	}
+
+	n := req.Count
+	if n > len(ids) {
+		n = len(ids)
+	}
+	res := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		res = append(res, ids[(start+i)%len(ids)])
+	}
+	s.last[req.TeamName] = res[len(res)-1]
+	return res
+}
+
+// LeastLoadedSelector prefers candidates with the smallest Load, breaking
+// ties at random.
+type LeastLoadedSelector struct {
+	rand Rand
+}
+
+func (s *LeastLoadedSelector) Select(req SelectRequest) []string {
+	cands := append([]Candidate(nil), req.Candidates...)
+	for i := range cands {
+		j := s.rand.Intn(i + 1)
+		cands[i], cands[j] = cands[j], cands[i]
+	}
+	sort.SliceStable(cands, func(i, j int) bool {
+		return cands[i].Load < cands[j].Load
+	})
+
+	ids := make([]string, 0, len(cands))
+	for _, c := range cands {
+		ids = append(ids, c.UserID)
+	}
+	return limit(ids, req.Count)
+}
+
+// WeightedSelector draws candidates at random with probability proportional
+// to their configured weight. Users without a weight get weight 1.
+type WeightedSelector struct {
+	rand    Rand
+	weights map[string]int
+}
+
+func (s *WeightedSelector) weight(userID string) int {
+	if w, ok := s.weights[userID]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+func (s *WeightedSelector) Select(req SelectRequest) []string {
+	pool := append([]Candidate(nil), req.Candidates...)
+
+	var res []string
+	for len(pool) > 0 && len(res) < req.Count {
+		total := 0
+		for _, c := range pool {
+			total += s.weight(c.UserID)
+		}
+
+		x := s.rand.Intn(total)
+		idx := 0
+		for i, c := range pool {
+			x -= s.weight(c.UserID)
+			if x < 0 {
+				idx = i
+				break
+			}
+		}
+
+		res = append(res, pool[idx].UserID)
+		pool = append(pool[:idx], pool[idx+1:]...)
+	}
+	return res
+}
+
+// PairAvoidingSelector spreads reviews over the team: it lets Next choose
+// among the candidates with the fewest RecentPairings first and moves on to
+// the next tier only when that one runs short.
+type PairAvoidingSelector struct {
+	Next ReviewerSelector
+}
+
+func (s *PairAvoidingSelector) Select(req SelectRequest) []string {
+	cands := append([]Candidate(nil), req.Candidates...)
+	sort.SliceStable(cands, func(i, j int) bool {
+		return cands[i].RecentPairings < cands[j].RecentPairings
+	})
+
+	var res []string
+	for start := 0; start < len(cands) && len(res) < req.Count; {
+		end := start
+		for end < len(cands) && cands[end].RecentPairings == cands[start].RecentPairings {
+			end++
+		}
+		res = append(res, s.Next.Select(SelectRequest{
+			TeamName:   req.TeamName,
+			Candidates: cands[start:end],
+			Count:      req.Count - len(res),
+		})...)
+		start = end
+	}
+	return res
+}
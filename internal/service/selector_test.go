@@ -0,0 +1,98 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+// The same seed must always give the same reviewers, so these are exact.
+func TestSelectorsSeeded(t *testing.T) {
+	candidates := []Candidate{
+		{UserID: "u1", Load: 3},
+		{UserID: "u2", Load: 0},
+		{UserID: "u3", Load: 1},
+		{UserID: "u4", Load: 0},
+		{UserID: "u5", Load: 2},
+	}
+	weights := map[string]int{"u1": 10, "u3": 5}
+
+	tests := []struct {
+		strategy string
+		want     [][]string // one entry per Select call
+	}{
+		{StrategyRandom, [][]string{{"u1", "u2"}, {"u4", "u2"}}},
+		{StrategyRoundRobin, [][]string{{"u1", "u2"}, {"u3", "u4"}}},
+		{StrategyLeastLoaded, [][]string{{"u2", "u4"}, {"u4", "u2"}}},
+		{StrategyWeighted, [][]string{{"u5", "u1"}, {"u3", "u2"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			sel, err := NewSelector(tt.strategy, weights, NewRand(42))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, want := range tt.want {
+				got := sel.Select(SelectRequest{TeamName: "backend", Candidates: candidates, Count: 2})
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("call %d: got %q, want %q", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPairAvoidingSelector(t *testing.T) {
+	sel := &PairAvoidingSelector{Next: NewRoundRobinSelector()}
+	got := sel.Select(SelectRequest{
+		TeamName: "backend",
+		Candidates: []Candidate{
+			{UserID: "u1", RecentPairings: 2},
+			{UserID: "u2"},
+			{UserID: "u3", RecentPairings: 1},
+			{UserID: "u4"},
+		},
+		Count: 3,
+	})
+	if want := []string{"u2", "u4", "u3"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+// Pairing tiers come before the strategy: whatever Next prefers, it only
+// chooses within the tier with the fewest pairings until that runs short.
+func TestPairAvoidingSelectorStrategies(t *testing.T) {
+	candidates := []Candidate{
+		{UserID: "u1", Load: 0, RecentPairings: 2},
+		{UserID: "u2", Load: 3},
+		{UserID: "u3", Load: 1, RecentPairings: 1},
+		{UserID: "u4", Load: 2},
+		{UserID: "u5", Load: 0, RecentPairings: 1},
+	}
+	weights := map[string]int{"u1": 100, "u3": 5}
+
+	tests := []struct {
+		strategy string
+		want     []string
+	}{
+		{StrategyRandom, []string{"u2", "u4", "u5"}},
+		// Round-robin is called once per tier and each call moves the
+		// cursor: tier 1 continues after u4.
+		{StrategyRoundRobin, []string{"u2", "u4", "u5"}},
+		// u1 has no load but already reviewed the author twice.
+		{StrategyLeastLoaded, []string{"u4", "u2", "u5"}},
+		{StrategyWeighted, []string{"u4", "u2", "u3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			next, err := NewSelector(tt.strategy, weights, NewRand(42))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sel := &PairAvoidingSelector{Next: next}
+			got := sel.Select(SelectRequest{TeamName: "backend", Candidates: candidates, Count: 3})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,7 +3,8 @@ package service
 import (
 	"context"
 	"errors"
-	"math/rand"
+	"fmt"
+	"sort"
 	"time"
 
 	"github.com/Mavichy/AvitoNovember/internal/model"
@@ -21,6 +22,15 @@ func NewDomainError(code model.ErrorCode, msg string) *DomainError {
 	return &DomainError{Code: code, Message: msg}
 }
 
+// ValidationError is an invalid request that could only be detected against
+// the stored state, e.g. a partial settings update. It is not a domain error:
+// the API reports it like any other malformed request.
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string { return e.Message }
+
 func AsDomainError(err error) (*DomainError, bool) {
 	var de *DomainError
 	if errors.As(err, &de) {
@@ -30,28 +40,98 @@ func AsDomainError(err error) (*DomainError, bool) {
 }
 
 type Service struct {
-	repo *repository.Repository
-	rand *rand.Rand
+	repo      Store
+	selectors Selectors
+	// pairWindow is how far back author→reviewer pairings are counted to
+	// spread reviews; 0 disables pair avoidance.
+	pairWindow time.Duration
+	metrics    serviceMetrics
+}
+
+type Option func(*Service)
+
+func WithSelectors(selectors Selectors) Option {
+	return func(s *Service) {
+		s.selectors = selectors
+	}
+}
+
+// WithPairAvoidance makes selection prefer reviewers who reviewed the
+// author least within window.
+func WithPairAvoidance(window time.Duration) Option {
+	return func(s *Service) {
+		s.pairWindow = window
+	}
 }
 
-func NewService(repo *repository.Repository) *Service {
-	return &Service{
+func NewService(repo Store, opts ...Option) *Service {
+	s := &Service{
 		repo: repo,
-		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+		selectors: Selectors{
+			Default: &RandomSelector{rand: newTimeSeededRand()},
+		},
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
+const defaultReviewerCount = 2
+
 func (s *Service) AddTeam(ctx context.Context, team model.Team) (model.Team, error) {
-	err := s.repo.CreateTeam(ctx, team.TeamName, team.Members)
+	if team.ReviewerCount == 0 {
+		team.ReviewerCount = defaultReviewerCount
+	}
+	if err := checkSettings(team.TeamSettings); err != nil {
+		return model.Team{}, err
+	}
+	if err := checkFallbackTeams(team.TeamName, team.FallbackTeams); err != nil {
+		return model.Team{}, err
+	}
+	normalizeMemberTags(team.Members)
+
+	err := s.repo.CreateTeam(ctx, team)
 	if err != nil {
 		if errors.Is(err, repository.ErrTeamExists) {
 			return model.Team{}, NewDomainError(model.ErrorCodeTeamExists, "team_name already exists")
 		}
+		if errors.Is(err, repository.ErrUserInOtherTeam) {
+			return model.Team{}, NewDomainError(model.ErrorCodeUserInOtherTeam, err.Error())
+		}
+		if errors.Is(err, repository.ErrTeamNotFound) {
+			return model.Team{}, NewDomainError(model.ErrorCodeNotFound, "parent or fallback team not found")
+		}
 		return model.Team{}, err
 	}
 	return s.repo.GetTeam(ctx, team.TeamName)
 }
 
+// checkSettings rejects a policy no pull request of the team could satisfy
+// without a forced merge.
+func checkSettings(settings model.TeamSettings) error {
+	if settings.RequiredApprovals > settings.ReviewerCount {
+		return &ValidationError{Message: "required_approvals must not exceed reviewer_count"}
+	}
+	return nil
+}
+
+// checkFallbackTeams rejects a list naming the team itself or repeating a
+// team, for both stores alike.
+func checkFallbackTeams(teamName string, fallbacks []string) error {
+	seen := make(map[string]struct{}, len(fallbacks))
+	for _, fb := range fallbacks {
+		if fb == teamName {
+			return &ValidationError{Message: "a team cannot be its own fallback"}
+		}
+		if _, ok := seen[fb]; ok {
+			return &ValidationError{Message: "duplicate fallback team " + fb}
+		}
+		seen[fb] = struct{}{}
+	}
+	return nil
+}
+
 func (s *Service) GetTeam(ctx context.Context, teamName string) (model.Team, error) {
 	team, err := s.repo.GetTeam(ctx, teamName)
 	if err != nil {
@@ -63,6 +143,66 @@ func (s *Service) GetTeam(ctx context.Context, teamName string) (model.Team, err
 	return team, nil
 }
 
+// UpdateTeamInput holds the team settings to change; nil fields are kept.
+type UpdateTeamInput struct {
+	TeamName          string
+	ReviewerCount     *int
+	RequiredApprovals *int
+	ClimbHierarchy    *bool
+	// FallbackTeams replaces the list of fallback teams when not nil.
+	FallbackTeams *[]string
+	// ParentTeam moves the team in the hierarchy; "" makes it top-level.
+	ParentTeam *string
+}
+
+func (s *Service) UpdateTeam(ctx context.Context, in UpdateTeamInput) (model.Team, error) {
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		settings, err := s.repo.GetTeamSettings(ctx, in.TeamName)
+		if err != nil {
+			return err
+		}
+
+		if in.ReviewerCount != nil {
+			settings.ReviewerCount = *in.ReviewerCount
+		}
+		if in.RequiredApprovals != nil {
+			settings.RequiredApprovals = *in.RequiredApprovals
+		}
+		if in.ClimbHierarchy != nil {
+			settings.ClimbHierarchy = *in.ClimbHierarchy
+		}
+		if err := checkSettings(settings); err != nil {
+			return err
+		}
+
+		if err := s.repo.SetTeamSettings(ctx, in.TeamName, settings); err != nil {
+			return err
+		}
+		if in.FallbackTeams != nil {
+			if err := checkFallbackTeams(in.TeamName, *in.FallbackTeams); err != nil {
+				return err
+			}
+			if err := s.repo.SetTeamFallbacks(ctx, in.TeamName, *in.FallbackTeams); err != nil {
+				return err
+			}
+		}
+		if in.ParentTeam != nil {
+			if err := s.checkParent(ctx, in.TeamName, *in.ParentTeam); err != nil {
+				return err
+			}
+			return s.repo.SetTeamParent(ctx, in.TeamName, *in.ParentTeam)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrTeamNotFound) {
+			return model.Team{}, NewDomainError(model.ErrorCodeNotFound, "team not found")
+		}
+		return model.Team{}, err
+	}
+	return s.GetTeam(ctx, in.TeamName)
+}
+
 func (s *Service) SetUserIsActive(ctx context.Context, userID string, isActive bool) (model.User, error) {
 	u, err := s.repo.SetUserActive(ctx, userID, isActive)
 	if err != nil {
@@ -74,6 +214,17 @@ func (s *Service) SetUserIsActive(ctx context.Context, userID string, isActive b
 	return u, nil
 }
 
+func (s *Service) SetUserCapacity(ctx context.Context, userID string, maxOpenReviews *int) (model.User, error) {
+	u, err := s.repo.SetUserCapacity(ctx, userID, maxOpenReviews)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return model.User{}, NewDomainError(model.ErrorCodeNotFound, "user not found")
+		}
+		return model.User{}, err
+	}
+	return u, nil
+}
+
 func (s *Service) GetUserReviews(ctx context.Context, userID string) (string, []model.PullRequestShort, error) {
 	prs, err := s.repo.GetPRsForReviewer(ctx, userID)
 	return userID, prs, err
@@ -83,9 +234,27 @@ type CreatePRInput struct {
 	ID       string
 	Name     string
 	AuthorID string
+	// Draft creates the PR in DRAFT status without reviewers.
+	Draft bool
+	// ChangedFiles routes the PR to the code owners of these paths.
+	ChangedFiles []string
+	// RequiredTags should each be covered by a reviewer when possible.
+	RequiredTags []string
 }
 
+// CreatePR creates a pull request and assigns reviewers in one transaction,
+// with the author and the candidate rows locked.
 func (s *Service) CreatePR(ctx context.Context, in CreatePRInput) (model.PullRequest, error) {
+	var pr model.PullRequest
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		var err error
+		pr, err = s.createPR(ctx, in)
+		return err
+	})
+	return pr, err
+}
+
+func (s *Service) createPR(ctx context.Context, in CreatePRInput) (model.PullRequest, error) {
 	author, err := s.repo.GetUser(ctx, in.AuthorID)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
@@ -94,33 +263,38 @@ func (s *Service) CreatePR(ctx context.Context, in CreatePRInput) (model.PullReq
 		return model.PullRequest{}, err
 	}
 
-	candidates, err := s.repo.GetActiveUsersByTeam(ctx, author.TeamName)
+	if author.TeamName == "" {
+		return model.PullRequest{}, NewDomainError(model.ErrorCodeNotFound, "author is not a member of any team")
+	}
+
+	settings, err := s.repo.GetTeamSettings(ctx, author.TeamName)
 	if err != nil {
 		if errors.Is(err, repository.ErrTeamNotFound) {
 			return model.PullRequest{}, NewDomainError(model.ErrorCodeNotFound, "team not found")
 		}
 		return model.PullRequest{}, err
 	}
-
-	var reviewerIDs []string
-	for _, u := range candidates {
-		if u.UserID == author.UserID {
-			continue
-		}
-		reviewerIDs = append(reviewerIDs, u.UserID)
-	}
-
-	s.shuffle(reviewerIDs)
-	if len(reviewerIDs) > 2 {
-		reviewerIDs = reviewerIDs[:2]
+	if err := s.checkTeamNotArchived(ctx, author.TeamName); err != nil {
+		return model.PullRequest{}, err
 	}
 
+	// Files and tags are stored for drafts too and used once the PR is ready.
 	pr := model.PullRequest{
-		ID:                in.ID,
-		Name:              in.Name,
-		AuthorID:          in.AuthorID,
-		Status:            model.StatusOpen,
-		AssignedReviewers: reviewerIDs,
+		ID:           in.ID,
+		Name:         in.Name,
+		AuthorID:     in.AuthorID,
+		Status:       model.StatusOpen,
+		ChangedFiles: in.ChangedFiles,
+		RequiredTags: normalizeTags(in.RequiredTags),
+	}
+	if in.Draft {
+		pr.Status = model.StatusDraft
+	} else {
+		pr.Reviews, err = s.pickReviewers(ctx, author, pr, settings.ReviewerCount)
+		if err != nil {
+			s.recordSelectionFailure(ctx, opCreate, err)
+			return model.PullRequest{}, err
+		}
 	}
 
 	if err := s.repo.CreatePRWithReviewers(ctx, pr); err != nil {
@@ -129,12 +303,48 @@ func (s *Service) CreatePR(ctx context.Context, in CreatePRInput) (model.PullReq
 		}
 		return model.PullRequest{}, err
 	}
+	s.recordAssignments(ctx, opCreate, len(pr.Reviews))
 
 	return s.repo.GetPR(ctx, in.ID)
 }
 
-func (s *Service) MergePR(ctx context.Context, prID string) (model.PullRequest, error) {
-	pr, err := s.repo.MarkPRMerged(ctx, prID)
+// MergePR marks the pull request as merged. Unless forcedBy names the user
+// forcing the merge, the author team's approval policy must be satisfied; a
+// forced merge is recorded on the PR with the user and the time. Merging an
+// already merged PR returns it unchanged.
+func (s *Service) MergePR(ctx context.Context, prID, forcedBy string) (model.PullRequest, error) {
+	var pr model.PullRequest
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		if forcedBy != "" {
+			if _, err := s.repo.GetUser(ctx, forcedBy); err != nil {
+				if errors.Is(err, repository.ErrUserNotFound) {
+					return NewDomainError(model.ErrorCodeNotFound, "user "+forcedBy+" not found")
+				}
+				return err
+			}
+		}
+
+		var err error
+		pr, err = s.repo.LockPR(ctx, prID)
+		if err != nil {
+			return err
+		}
+		if pr.Status == model.StatusMerged {
+			return nil
+		}
+		if err := checkTransition(pr.Status, model.StatusMerged); err != nil {
+			return err
+		}
+
+		if forcedBy == "" {
+			if err := s.checkMergePolicy(ctx, pr); err != nil {
+				return err
+			}
+		}
+
+		pr, err = s.repo.MarkPRMerged(ctx, prID, forcedBy)
+		return err
+	})
 	if err != nil {
 		if errors.Is(err, repository.ErrPRNotFound) {
 			return model.PullRequest{}, NewDomainError(model.ErrorCodeNotFound, "pull request not found")
@@ -144,21 +354,111 @@ func (s *Service) MergePR(ctx context.Context, prID string) (model.PullRequest,
 	return pr, nil
 }
 
+func (s *Service) checkMergePolicy(ctx context.Context, pr model.PullRequest) error {
+	author, err := s.repo.GetUser(ctx, pr.AuthorID)
+	if err != nil {
+		return err
+	}
+	settings, err := s.teamSettings(ctx, author)
+	if err != nil {
+		return err
+	}
+	if settings.RequiredApprovals <= 0 {
+		return nil
+	}
+
+	approvals := 0
+	for _, rv := range pr.Reviews {
+		switch rv.State {
+		case model.ReviewApproved:
+			approvals++
+		case model.ReviewChangesRequested:
+			return NewDomainError(model.ErrorCodeMergeBlocked, "reviewer "+rv.ReviewerID+" requested changes")
+		}
+	}
+	if approvals < settings.RequiredApprovals {
+		return NewDomainError(model.ErrorCodeMergeBlocked,
+			fmt.Sprintf("%d of %d required approvals", approvals, settings.RequiredApprovals))
+	}
+	return nil
+}
+
+// SubmitReview records the reviewer's decision on an open pull request.
+func (s *Service) SubmitReview(ctx context.Context, prID, reviewerID string, state model.ReviewState) (model.PullRequest, error) {
+	var pr model.PullRequest
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		var err error
+		pr, err = s.repo.LockPR(ctx, prID)
+		if err != nil {
+			if errors.Is(err, repository.ErrPRNotFound) {
+				return NewDomainError(model.ErrorCodeNotFound, "pull request not found")
+			}
+			return err
+		}
+
+		if pr.Status == model.StatusMerged {
+			return NewDomainError(model.ErrorCodePRMerged, "cannot review merged PR")
+		}
+		if pr.Status != model.StatusOpen {
+			return NewDomainError(model.ErrorCodePRNotOpen, "cannot review "+string(pr.Status)+" PR")
+		}
+
+		if err := s.repo.SetReviewState(ctx, prID, reviewerID, state); err != nil {
+			if errors.Is(err, repository.ErrNotAssigned) {
+				return NewDomainError(model.ErrorCodeNotAssigned, "reviewer is not assigned to this PR")
+			}
+			return err
+		}
+
+		pr, err = s.repo.GetPR(ctx, prID)
+		return err
+	})
+	return pr, err
+}
+
 type ReassignResult struct {
 	PR         model.PullRequest
 	ReplacedBy string
 }
 
+// ReviewerChange describes a reviewer taken off a pull request.
+// NewReviewerID is empty when the reviewer was removed without replacement.
+type ReviewerChange struct {
+	PullRequestID string `json:"pull_request_id"`
+	OldReviewerID string `json:"old_reviewer_id"`
+	NewReviewerID string `json:"new_reviewer_id,omitempty"`
+}
+
 type BulkDeactivateResult struct {
-	TeamName             string   `json:"team_name"`
-	Deactivated          []string `json:"deactivated"`
-	ReassignedReviewers  int      `json:"reassigned_reviewers"`
-	RemovedReviewers     int      `json:"removed_reviewers"`
-	AffectedPullRequests int      `json:"affected_pull_requests"`
+	TeamName             string           `json:"team_name"`
+	DryRun               bool             `json:"dry_run"`
+	Deactivated          []string         `json:"deactivated"`
+	ReassignedReviewers  int              `json:"reassigned_reviewers"`
+	RemovedReviewers     int              `json:"removed_reviewers"`
+	AffectedPullRequests int              `json:"affected_pull_requests"`
+	Changes              []ReviewerChange `json:"changes"`
 }
 
+// ReassignReviewer replaces oldUserID on the pull request in one transaction,
+// holding locks on the pull request and the candidate rows, so concurrent
+// reassigns and merges of the same PR are serialized.
 func (s *Service) ReassignReviewer(ctx context.Context, prID, oldUserID string) (ReassignResult, error) {
-	pr, err := s.repo.GetPR(ctx, prID)
+	var res ReassignResult
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = s.reassignReviewer(ctx, prID, oldUserID)
+		return err
+	})
+	if err != nil {
+		s.recordSelectionFailure(ctx, opReassign, err)
+	} else {
+		s.recordAssignments(ctx, opReassign, 1)
+	}
+	return res, err
+}
+
+func (s *Service) reassignReviewer(ctx context.Context, prID, oldUserID string) (ReassignResult, error) {
+	pr, err := s.repo.LockPR(ctx, prID)
 	if err != nil {
 		if errors.Is(err, repository.ErrPRNotFound) {
 			return ReassignResult{}, NewDomainError(model.ErrorCodeNotFound, "pull request not found")
@@ -169,6 +469,9 @@ func (s *Service) ReassignReviewer(ctx context.Context, prID, oldUserID string)
 	if pr.Status == model.StatusMerged {
 		return ReassignResult{}, NewDomainError(model.ErrorCodePRMerged, "cannot reassign on merged PR")
 	}
+	if pr.Status != model.StatusOpen {
+		return ReassignResult{}, NewDomainError(model.ErrorCodePRNotOpen, "cannot reassign on "+string(pr.Status)+" PR")
+	}
 
 	oldUser, err := s.repo.GetUser(ctx, oldUserID)
 	if err != nil {
@@ -189,35 +492,64 @@ func (s *Service) ReassignReviewer(ctx context.Context, prID, oldUserID string)
 		return ReassignResult{}, NewDomainError(model.ErrorCodeNotAssigned, "reviewer is not assigned to this PR")
 	}
 
-	candidates, err := s.repo.GetActiveUsersByTeam(ctx, oldUser.TeamName)
+	author, err := s.repo.GetUser(ctx, pr.AuthorID)
 	if err != nil {
-		if errors.Is(err, repository.ErrTeamNotFound) {
-			return ReassignResult{}, NewDomainError(model.ErrorCodeNotFound, "team not found")
+		return ReassignResult{}, err
+	}
+	var (
+		groups []ownerGroup
+		mode   model.CodeOwnersMode
+	)
+	if author.TeamName != "" {
+		groups, mode, err = s.codeOwnerGroups(ctx, author.TeamName, pr.ChangedFiles)
+		if err != nil {
+			return ReassignResult{}, err
 		}
+	}
+
+	// A reviewer left without a team is replaced from the author's team.
+	poolTeam := oldUser.TeamName
+	if poolTeam == "" {
+		poolTeam = author.TeamName
+	}
+	exclude := append([]string{oldUserID, pr.AuthorID}, pr.AssignedReviewers...)
+	pools, err := s.reviewerPools(ctx, poolTeam, exclude)
+	if err != nil {
 		return ReassignResult{}, err
 	}
 
-	assignedSet := make(map[string]struct{}, len(pr.AssignedReviewers))
-	for _, rid := range pr.AssignedReviewers {
-		assignedSet[rid] = struct{}{}
+	locked, err := s.lockUsers(ctx, append(append(poolUserIDs(pools), ownerUserIDs(groups)...), pr.AssignedReviewers...))
+	if err != nil {
+		return ReassignResult{}, err
 	}
-	assignedSet[oldUserID] = struct{}{}
-	assignedSet[pr.AuthorID] = struct{}{}
 
-	var eligible []string
-	for _, u := range candidates {
-		if _, bad := assignedSet[u.UserID]; bad {
-			continue
-		}
-		eligible = append(eligible, u.UserID)
+	// Paths and tags that only oldUserID covered go to another owner or
+	// tagged member if possible.
+	remaining := removeID(pr.AssignedReviewers, oldUserID)
+	picked, unowned, err := s.pickOwners(ctx, pr.AuthorID, groups, locked, remaining, exclude, 1)
+	if err != nil {
+		return ReassignResult{}, err
+	}
+	if len(picked) == 0 && len(unowned) > 0 && mode == model.CodeOwnersRequire {
+		return ReassignResult{}, noCodeOwnerError(unowned[0])
 	}
 
-	if len(eligible) == 0 {
+	if len(picked) == 0 {
+		picked, err = s.pickTagged(ctx, pr.AuthorID, pools, locked, pr.RequiredTags, remaining, 1)
+		if err != nil {
+			return ReassignResult{}, err
+		}
+	}
+	if len(picked) == 0 {
+		picked, err = s.selectFromPools(ctx, pr.AuthorID, pools, locked, 1)
+		if err != nil {
+			return ReassignResult{}, err
+		}
+	}
+	if len(picked) == 0 {
 		return ReassignResult{}, NewDomainError(model.ErrorCodeNoCandidate, "no active replacement candidate in team")
 	}
-
-	s.shuffle(eligible)
-	newReviewer := eligible[0]
+	newReviewer := picked[0]
 
 	if err := s.repo.ReassignReviewer(ctx, prID, oldUserID, newReviewer); err != nil {
 		return ReassignResult{}, err
@@ -230,55 +562,232 @@ func (s *Service) ReassignReviewer(ctx context.Context, prID, oldUserID string)
 
 	return ReassignResult{
 		PR:         updated,
-		ReplacedBy: newReviewer,
+		ReplacedBy: newReviewer.ReviewerID,
 	}, nil
 }
 
-func (s *Service) shuffle(ids []string) {
-	for i := range ids {
-		j := s.rand.Intn(i + 1)
-		ids[i], ids[j] = ids[j], ids[i]
+// pickReviewers chooses up to count more reviewers for pr. Code owners of
+// the changed files come first; in require mode every owned path gets an
+// owner, even beyond count. Then a member having each required tag not yet
+// covered is picked when there is one, and the rest are active members of the
+// author's team and then of its fallback teams. The author, the reviewers
+// already assigned and the candidate rows are locked.
+func (s *Service) pickReviewers(ctx context.Context, author model.User, pr model.PullRequest, count int) ([]model.Review, error) {
+	if author.TeamName == "" {
+		return nil, nil
+	}
+
+	groups, mode, err := s.codeOwnerGroups(ctx, author.TeamName, pr.ChangedFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	exclude := pr.AssignedReviewers
+	skip := append([]string{author.UserID}, exclude...)
+	pools, err := s.reviewerPools(ctx, author.TeamName, skip)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := append(append(skip, poolUserIDs(pools)...), ownerUserIDs(groups)...)
+	locked, err := s.lockUsers(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	if a, ok := locked[author.UserID]; !ok || a.TeamName != author.TeamName {
+		return nil, NewDomainError(model.ErrorCodeNotFound, "author not found")
+	}
+
+	maxOwners := count
+	if mode == model.CodeOwnersRequire {
+		maxOwners = len(groups)
+	}
+	owners, unowned, err := s.pickOwners(ctx, author.UserID, groups, locked, exclude, skip, maxOwners)
+	if err != nil {
+		return nil, err
+	}
+	if mode == model.CodeOwnersRequire && len(unowned) > 0 {
+		return nil, noCodeOwnerError(unowned[0])
+	}
+	picked := owners
+	if len(picked) >= count {
+		return picked, nil
+	}
+
+	covered := append(append([]string(nil), exclude...), reviewerIDs(owners)...)
+	tagged, err := s.pickTagged(ctx, author.UserID, withoutPicked(pools, picked), locked, pr.RequiredTags, covered, count-len(picked))
+	if err != nil {
+		return nil, err
+	}
+	picked = append(picked, tagged...)
+	if len(picked) >= count {
+		return picked, nil
+	}
+
+	rest, err := s.selectFromPools(ctx, author.UserID, withoutPicked(pools, picked), locked, count-len(picked))
+	if de, ok := AsDomainError(err); ok && de.Code == model.ErrorCodeNoCandidate && len(picked) > 0 {
+		return picked, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(picked, rest...), nil
+}
+
+func (s *Service) lockUsers(ctx context.Context, userIDs []string) (map[string]model.User, error) {
+	users, err := s.repo.LockUsers(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]model.User, len(users))
+	for _, u := range users {
+		res[u.UserID] = u
 	}
+	return res, nil
 }
 
-func (s *Service) DeactivateTeamUsersAndReassign(ctx context.Context, teamName string, userIDs []string) (BulkDeactivateResult, error) {
+// lockReviewedPRs locks the open pull requests userIDs review, in id order.
+// Pull requests are always locked before user rows, as reassignReviewer does,
+// so operations that release reviews from several PRs cannot deadlock with a
+// concurrent reassign.
+func (s *Service) lockReviewedPRs(ctx context.Context, userIDs []string) error {
+	seen := make(map[string]struct{})
+	var prIDs []string
+	for _, uid := range userIDs {
+		prs, err := s.repo.GetPRsForReviewer(ctx, uid)
+		if err != nil {
+			return err
+		}
+		for _, pr := range prs {
+			if _, ok := seen[pr.ID]; ok || pr.Status != model.StatusOpen {
+				continue
+			}
+			seen[pr.ID] = struct{}{}
+			prIDs = append(prIDs, pr.ID)
+		}
+	}
+	sort.Strings(prIDs)
+
+	for _, id := range prIDs {
+		if _, err := s.repo.LockPR(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stillActiveIn keeps the ids whose locked rows are still active members of teamName.
+func stillActiveIn(locked map[string]model.User, teamName string, userIDs []string) []string {
+	var res []string
+	for _, id := range userIDs {
+		if u, ok := locked[id]; ok && u.IsActive && u.TeamName == teamName {
+			res = append(res, id)
+		}
+	}
+	return res
+}
+
+// selectReviewers picks count reviewers among userIDs for a PR by authorID
+// with the team's strategy. Users that reached their max_open_reviews are
+// skipped; if that leaves nobody, NO_CANDIDATE is returned. With pair
+// avoidance on, users who reviewed the author least within the window are
+// preferred. locked must hold the users' rows.
+func (s *Service) selectReviewers(ctx context.Context, teamName, authorID string, locked map[string]model.User, userIDs []string, count int) ([]string, error) {
+	if len(userIDs) == 0 || count <= 0 {
+		return nil, nil
+	}
+
+	load, err := s.repo.GetOpenReviewCounts(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var pairs map[string]int
+	if s.pairWindow > 0 && authorID != "" {
+		pairs, err = s.repo.GetPairCounts(ctx, authorID, userIDs, time.Now().Add(-s.pairWindow))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	candidates := make([]Candidate, 0, len(userIDs))
+	for _, id := range userIDs {
+		if limit := locked[id].MaxOpenReviews; limit != nil && load[id] >= *limit {
+			continue
+		}
+		candidates = append(candidates, Candidate{UserID: id, Load: load[id], RecentPairings: pairs[id]})
+	}
+	if len(candidates) == 0 {
+		return nil, NewDomainError(model.ErrorCodeNoCandidate,
+			fmt.Sprintf("all %d candidates in team %s are at their review capacity", len(userIDs), teamName))
+	}
+
+	sel := s.selectors.For(teamName)
+	if s.pairWindow > 0 {
+		sel = &PairAvoidingSelector{Next: sel}
+	}
+	return sel.Select(SelectRequest{
+		TeamName:   teamName,
+		Candidates: candidates,
+		Count:      count,
+	}), nil
+}
+
+var errDryRun = errors.New("dry run")
+
+// DeactivateTeamUsersAndReassign deactivates the users and moves their open
+// reviews in a single transaction: either everything is applied or nothing.
+// With dryRun the planned changes are computed and rolled back.
+func (s *Service) DeactivateTeamUsersAndReassign(ctx context.Context, teamName string, userIDs []string, dryRun bool) (BulkDeactivateResult, error) {
 	res := BulkDeactivateResult{
 		TeamName: teamName,
+		DryRun:   dryRun,
 	}
 
+	userIDs = uniqueIDs(userIDs)
 	if len(userIDs) == 0 {
 		return res, nil
 	}
 
-	var toProcess []string
-	for _, uid := range userIDs {
-		user, err := s.repo.GetUser(ctx, uid)
+	if dryRun {
+		ctx = withoutMetrics(ctx)
+	}
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = s.deactivateTeamUsersAndReassign(ctx, teamName, userIDs)
 		if err != nil {
-			if errors.Is(err, repository.ErrUserNotFound) {
-				return res, NewDomainError(model.ErrorCodeNotFound, "user "+uid+" not found")
-			}
-			return res, err
+			return err
 		}
-		if user.TeamName != teamName {
-			return res, NewDomainError(model.ErrorCodeNotFound, "user "+uid+" does not belong to team "+teamName)
+		if dryRun {
+			return errDryRun
 		}
+		return nil
+	})
+	res.DryRun = dryRun
+	if err != nil && !errors.Is(err, errDryRun) {
+		return BulkDeactivateResult{TeamName: teamName, DryRun: dryRun}, err
+	}
+	return res, nil
+}
 
-		if user.IsActive {
-			if _, err := s.repo.SetUserActive(ctx, uid, false); err != nil {
-				if errors.Is(err, repository.ErrUserNotFound) {
-					return res, NewDomainError(model.ErrorCodeNotFound, "user "+uid+" not found")
-				}
-				return res, err
-			}
-		}
+func (s *Service) deactivateTeamUsersAndReassign(ctx context.Context, teamName string, userIDs []string) (BulkDeactivateResult, error) {
+	res := BulkDeactivateResult{
+		TeamName: teamName,
+	}
 
-		toProcess = append(toProcess, uid)
+	if err := s.lockReviewedPRs(ctx, userIDs); err != nil {
+		return res, err
+	}
+	for _, uid := range userIDs {
+		if err := s.deactivateTeamUser(ctx, teamName, uid); err != nil {
+			return res, err
+		}
 		res.Deactivated = append(res.Deactivated, uid)
 	}
 
 	affectedPRs := make(map[string]struct{})
 
-	for _, uid := range toProcess {
+	for _, uid := range res.Deactivated {
 		_, prs, err := s.GetUserReviews(ctx, uid)
 		if err != nil {
 			return res, err
@@ -289,23 +798,21 @@ func (s *Service) DeactivateTeamUsersAndReassign(ctx context.Context, teamName s
 				continue
 			}
 
-			rr, err := s.ReassignReviewer(ctx, prShort.ID, uid)
-			if err == nil {
-				res.ReassignedReviewers++
-				affectedPRs[rr.PR.ID] = struct{}{}
+			change, changed, err := s.releaseReviewer(ctx, prShort.ID, uid)
+			if err != nil {
+				return res, err
+			}
+			if !changed {
 				continue
 			}
 
-			if de, ok := AsDomainError(err); ok && de.Code == model.ErrorCodeNoCandidate {
-				if err := s.repo.RemoveReviewer(ctx, prShort.ID, uid); err != nil {
-					return res, err
-				}
+			if change.NewReviewerID != "" {
+				res.ReassignedReviewers++
+			} else {
 				res.RemovedReviewers++
-				affectedPRs[prShort.ID] = struct{}{}
-				continue
 			}
-
-			return res, err
+			res.Changes = append(res.Changes, change)
+			affectedPRs[prShort.ID] = struct{}{}
 		}
 	}
 
@@ -313,6 +820,132 @@ func (s *Service) DeactivateTeamUsersAndReassign(ctx context.Context, teamName s
 	return res, nil
 }
 
-func (s *Service) GetReviewerStats(ctx context.Context) ([]model.ReviewerStatsItem, error) {
-	return s.repo.GetReviewerStats(ctx)
+func (s *Service) deactivateTeamUser(ctx context.Context, teamName, uid string) error {
+	locked, err := s.lockUsers(ctx, []string{uid})
+	if err != nil {
+		return err
+	}
+	user, ok := locked[uid]
+	if !ok {
+		return NewDomainError(model.ErrorCodeNotFound, "user "+uid+" not found")
+	}
+	if user.TeamName != teamName {
+		return NewDomainError(model.ErrorCodeNotFound, "user "+uid+" does not belong to team "+teamName)
+	}
+
+	if user.IsActive {
+		if _, err := s.repo.SetUserActive(ctx, uid, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseReviewer takes uid off an open pull request, replacing them when the
+// PR would otherwise have fewer reviewers than its team requires. Must run in
+// a transaction. The returned bool is false if the PR was left untouched.
+func (s *Service) releaseReviewer(ctx context.Context, prID, uid string) (ReviewerChange, bool, error) {
+	change := ReviewerChange{PullRequestID: prID, OldReviewerID: uid}
+
+	pr, err := s.repo.LockPR(ctx, prID)
+	if err != nil {
+		return change, false, err
+	}
+	if pr.Status != model.StatusOpen || !contains(pr.AssignedReviewers, uid) {
+		return change, false, nil
+	}
+
+	// The PR keeps enough reviewers without uid (e.g. the team's
+	// reviewer_count was lowered), so there is nothing to replace.
+	enough, err := s.hasEnoughReviewersWithout(ctx, pr, uid)
+	if err != nil {
+		return change, false, err
+	}
+	if !enough {
+		rr, err := s.reassignReviewer(ctx, prID, uid)
+		if err == nil {
+			s.recordAssignments(ctx, opRelease, 1)
+			change.NewReviewerID = rr.ReplacedBy
+			return change, true, nil
+		}
+		// Without a replacement uid is still taken off the PR: a reviewer
+		// who is leaving must not block deactivation or an absence.
+		s.recordSelectionFailure(ctx, opRelease, err)
+		if de, ok := AsDomainError(err); !ok ||
+			(de.Code != model.ErrorCodeNoCandidate && de.Code != model.ErrorCodeNoCodeOwner) {
+			return change, false, err
+		}
+	}
+
+	if err := s.repo.RemoveReviewer(ctx, prID, uid); err != nil {
+		return change, false, err
+	}
+	return change, true, nil
+}
+
+// uniqueIDs returns ids without repeats, keeping the first occurrence.
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]struct{}, len(ids))
+	res := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		res = append(res, id)
+	}
+	return res
+}
+
+// removeID returns a copy of ids without id.
+func removeID(ids []string, id string) []string {
+	res := make([]string, 0, len(ids))
+	for _, v := range ids {
+		if v != id {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func contains(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) hasEnoughReviewersWithout(ctx context.Context, pr model.PullRequest, reviewerID string) (bool, error) {
+	author, err := s.repo.GetUser(ctx, pr.AuthorID)
+	if err != nil {
+		return false, err
+	}
+	settings, err := s.teamSettings(ctx, author)
+	if err != nil {
+		return false, err
+	}
+
+	remaining := 0
+	for _, rid := range pr.AssignedReviewers {
+		if rid != reviewerID {
+			remaining++
+		}
+	}
+	return remaining >= settings.ReviewerCount, nil
+}
+
+// GetReviewerStats returns per-user assignment counts, busiest first.
+// Users without matching assignments are listed with zero counts.
+func (s *Service) GetReviewerStats(ctx context.Context, f model.ReviewerStatsFilter) ([]model.ReviewerStatsItem, error) {
+	if f.TeamName != "" {
+		if _, err := s.repo.GetTeamSettings(ctx, f.TeamName); err != nil {
+			if errors.Is(err, repository.ErrTeamNotFound) {
+				return nil, NewDomainError(model.ErrorCodeNotFound, "team not found")
+			}
+			return nil, err
+		}
+	}
+	return s.repo.GetReviewerStats(ctx, f)
 }
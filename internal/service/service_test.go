@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+	"github.com/Mavichy/AvitoNovember/internal/repository"
+)
+
+func newTestService(t *testing.T) (*Service, *repository.MemoryRepository) {
+	t.Helper()
+	repo := repository.NewMemoryRepository()
+	selectors, err := NewSelectors(StrategyRoundRobin, nil, nil, NewRand(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewService(repo, WithSelectors(selectors)), repo
+}
+
+func addTestTeam(t *testing.T, svc *Service, name string, userIDs ...string) {
+	t.Helper()
+	team := model.Team{TeamName: name}
+	for _, id := range userIDs {
+		team.Members = append(team.Members, model.TeamMember{UserID: id, Username: id, IsActive: true})
+	}
+	if _, err := svc.AddTeam(context.Background(), team); err != nil {
+		t.Fatalf("AddTeam(%s): %v", name, err)
+	}
+}
+
+func wantCode(t *testing.T, err error, code model.ErrorCode) {
+	t.Helper()
+	de, ok := AsDomainError(err)
+	if !ok || de.Code != code {
+		t.Fatalf("got error %v, want %s", err, code)
+	}
+}
+
+func TestPullRequestFlow(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	addTestTeam(t, svc, "backend", "u1", "u2", "u3", "u4")
+
+	_, err := svc.AddTeam(ctx, model.Team{TeamName: "backend"})
+	wantCode(t, err, model.ErrorCodeTeamExists)
+
+	pr, err := svc.CreatePR(ctx, CreatePRInput{ID: "pr-1", Name: "Add search", AuthorID: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Status != model.StatusOpen {
+		t.Fatalf("status = %s, want OPEN", pr.Status)
+	}
+	// Round-robin walks the members in user_id order, the author excluded.
+	if got := pr.AssignedReviewers; len(got) != 2 || got[0] != "u2" || got[1] != "u3" {
+		t.Fatalf("reviewers = %v, want [u2 u3]", got)
+	}
+
+	_, err = svc.CreatePR(ctx, CreatePRInput{ID: "pr-1", Name: "again", AuthorID: "u1"})
+	wantCode(t, err, model.ErrorCodePRExists)
+
+	res, err := svc.ReassignReviewer(ctx, "pr-1", "u2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ReplacedBy != "u4" {
+		t.Fatalf("replaced by %s, want u4", res.ReplacedBy)
+	}
+	if contains(res.PR.AssignedReviewers, "u2") || !contains(res.PR.AssignedReviewers, "u4") {
+		t.Fatalf("reviewers after reassign = %v", res.PR.AssignedReviewers)
+	}
+
+	_, err = svc.ReassignReviewer(ctx, "pr-1", "u2")
+	wantCode(t, err, model.ErrorCodeNotAssigned)
+
+	// The only member left who does not review the PR is inactive.
+	if _, err := svc.SetUserIsActive(ctx, "u2", false); err != nil {
+		t.Fatal(err)
+	}
+	_, err = svc.ReassignReviewer(ctx, "pr-1", "u3")
+	wantCode(t, err, model.ErrorCodeNoCandidate)
+
+	merged, err := svc.MergePR(ctx, "pr-1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Status != model.StatusMerged || merged.MergedAt == nil {
+		t.Fatalf("after merge: status %s, mergedAt %v", merged.Status, merged.MergedAt)
+	}
+
+	again, err := svc.MergePR(ctx, "pr-1", "")
+	if err != nil {
+		t.Fatalf("repeated merge: %v", err)
+	}
+	if !again.MergedAt.Equal(*merged.MergedAt) {
+		t.Fatalf("repeated merge changed mergedAt")
+	}
+
+	_, err = svc.ReassignReviewer(ctx, "pr-1", "u3")
+	wantCode(t, err, model.ErrorCodePRMerged)
+}
+
+func TestInTxRollback(t *testing.T) {
+	ctx := context.Background()
+	svc, repo := newTestService(t)
+	addTestTeam(t, svc, "backend", "u1", "u2", "u3")
+
+	errBoom := errors.New("boom")
+	err := repo.InTx(ctx, func(ctx context.Context) error {
+		if _, err := svc.CreatePR(ctx, CreatePRInput{ID: "pr-1", Name: "x", AuthorID: "u1"}); err != nil {
+			return err
+		}
+		if _, err := svc.SetUserIsActive(ctx, "u2", false); err != nil {
+			return err
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("InTx = %v, want %v", err, errBoom)
+	}
+
+	if _, err := repo.GetPR(ctx, "pr-1"); !errors.Is(err, repository.ErrPRNotFound) {
+		t.Fatalf("GetPR after rollback = %v, want ErrPRNotFound", err)
+	}
+	u, err := repo.GetUser(ctx, "u2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.IsActive {
+		t.Fatalf("u2 deactivated despite rollback")
+	}
+	_, reviews, err := svc.GetUserReviews(ctx, "u2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reviews) != 0 {
+		t.Fatalf("u2 reviews after rollback = %v", reviews)
+	}
+}
+
+func TestApprovalsCannotExceedReviewerCount(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+
+	var ve *ValidationError
+	_, err := svc.AddTeam(ctx, model.Team{TeamName: "backend", TeamSettings: model.TeamSettings{RequiredApprovals: 3}})
+	if !errors.As(err, &ve) {
+		t.Fatalf("AddTeam with 3 approvals of 2 reviewers = %v, want ValidationError", err)
+	}
+
+	addTestTeam(t, svc, "backend", "u1", "u2", "u3")
+	one, three := 1, 3
+	if _, err := svc.UpdateTeam(ctx, UpdateTeamInput{TeamName: "backend", RequiredApprovals: &three}); !errors.As(err, &ve) {
+		t.Fatalf("UpdateTeam required_approvals=3 = %v, want ValidationError", err)
+	}
+
+	two := 2
+	if _, err := svc.UpdateTeam(ctx, UpdateTeamInput{TeamName: "backend", RequiredApprovals: &two}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.UpdateTeam(ctx, UpdateTeamInput{TeamName: "backend", ReviewerCount: &one}); !errors.As(err, &ve) {
+		t.Fatalf("UpdateTeam reviewer_count=1 below 2 approvals = %v, want ValidationError", err)
+	}
+}
+
+func TestForcedMergeIsAudited(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	addTestTeam(t, svc, "backend", "u1", "u2", "u3")
+	two := 2
+	if _, err := svc.UpdateTeam(ctx, UpdateTeamInput{TeamName: "backend", RequiredApprovals: &two}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.CreatePR(ctx, CreatePRInput{ID: "pr-1", Name: "x", AuthorID: "u1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := svc.MergePR(ctx, "pr-1", "")
+	wantCode(t, err, model.ErrorCodeMergeBlocked)
+
+	_, err = svc.MergePR(ctx, "pr-1", "nobody")
+	wantCode(t, err, model.ErrorCodeNotFound)
+
+	pr, err := svc.MergePR(ctx, "pr-1", "u3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pr.ForceMerged || pr.ForcedBy != "u3" || pr.ForcedAt == nil {
+		t.Fatalf("forced merge recorded as %v by %q at %v", pr.ForceMerged, pr.ForcedBy, pr.ForcedAt)
+	}
+
+	// A repeated forced merge keeps the original record.
+	again, err := svc.MergePR(ctx, "pr-1", "u2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ForcedBy != "u3" || !again.ForcedAt.Equal(*pr.ForcedAt) {
+		t.Fatalf("repeated merge changed the audit record: %q at %v", again.ForcedBy, again.ForcedAt)
+	}
+}
+
+func TestArchivedTeamPRsStayOutOfReview(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	addTestTeam(t, svc, "backend", "u1", "u2", "u3")
+
+	if _, err := svc.CreatePR(ctx, CreatePRInput{ID: "draft", Name: "x", AuthorID: "u1", Draft: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.CreatePR(ctx, CreatePRInput{ID: "closed", Name: "x", AuthorID: "u1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ClosePR(ctx, "closed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ArchiveTeam(ctx, "backend"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := svc.CreatePR(ctx, CreatePRInput{ID: "new", Name: "x", AuthorID: "u1"})
+	wantCode(t, err, model.ErrorCodeTeamArchived)
+	_, err = svc.MarkPRReady(ctx, "draft")
+	wantCode(t, err, model.ErrorCodeTeamArchived)
+	_, err = svc.ReopenPR(ctx, "closed")
+	wantCode(t, err, model.ErrorCodeTeamArchived)
+
+	// Closing is still allowed.
+	if _, err := svc.ClosePR(ctx, "draft"); err != nil {
+		t.Fatal(err)
+	}
+}
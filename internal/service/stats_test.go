@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+)
+
+func TestReviewerStatsFilters(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	addTestTeam(t, svc, "backend", "a", "b", "c")
+	addTestTeam(t, svc, "frontend", "f1", "f2")
+
+	for _, in := range []CreatePRInput{
+		{ID: "open", Name: "open", AuthorID: "a"},
+		{ID: "merged", Name: "merged", AuthorID: "a"},
+		{ID: "closed", Name: "closed", AuthorID: "f1"},
+	} {
+		if _, err := svc.CreatePR(ctx, in); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := svc.MergePR(ctx, "merged", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ClosePR(ctx, "closed"); err != nil {
+		t.Fatal(err)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		name   string
+		filter model.ReviewerStatsFilter
+		want   map[string][3]int // user -> review, open, completed
+	}{
+		{"all", model.ReviewerStatsFilter{}, map[string][3]int{
+			"a": {}, "b": {2, 1, 1}, "c": {2, 1, 1}, "f1": {}, "f2": {1, 0, 1},
+		}},
+		{"team", model.ReviewerStatsFilter{TeamName: "frontend"}, map[string][3]int{
+			"f1": {}, "f2": {1, 0, 1},
+		}},
+		{"status", model.ReviewerStatsFilter{Status: model.StatusMerged}, map[string][3]int{
+			"a": {}, "b": {1, 0, 1}, "c": {1, 0, 1}, "f1": {}, "f2": {},
+		}},
+		{"period", model.ReviewerStatsFilter{From: &past, To: &future, TeamName: "backend"}, map[string][3]int{
+			"a": {}, "b": {2, 1, 1}, "c": {2, 1, 1},
+		}},
+		{"to is exclusive", model.ReviewerStatsFilter{To: &past, TeamName: "backend"}, map[string][3]int{
+			"a": {}, "b": {}, "c": {},
+		}},
+		{"from", model.ReviewerStatsFilter{From: &future, TeamName: "backend"}, map[string][3]int{
+			"a": {}, "b": {}, "c": {},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := svc.GetReviewerStats(ctx, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string][3]int, len(items))
+			for i, it := range items {
+				got[it.UserID] = [3]int{it.ReviewCount, it.OpenCount, it.CompletedCount}
+				if i > 0 && items[i-1].ReviewCount < it.ReviewCount {
+					t.Fatalf("items are not sorted by review count: %+v", items)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for id, want := range tt.want {
+				if got[id] != want {
+					t.Fatalf("%s: got %v, want %v", id, got[id], want)
+				}
+			}
+		})
+	}
+
+	_, err := svc.GetReviewerStats(ctx, model.ReviewerStatsFilter{TeamName: "nope"})
+	wantCode(t, err, model.ErrorCodeNotFound)
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+	"github.com/Mavichy/AvitoNovember/internal/repository"
+)
+
+// Store is the persistence layer the service depends on. It is implemented
+// by repository.Repository (PostgreSQL) and repository.MemoryRepository.
+type Store interface {
+	// InTx runs fn in a transaction. Store calls made with the context passed
+	// to fn are part of it; the transaction is rolled back if fn fails.
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+
+	CreateTeam(ctx context.Context, team model.Team) error
+	GetTeam(ctx context.Context, teamName string) (model.Team, error)
+	// AddTeamMembers adds users to an existing team; members of other teams
+	// are rejected with repository.ErrUserInOtherTeam.
+	AddTeamMembers(ctx context.Context, teamName string, members []model.TeamMember) error
+	GetTeamSettings(ctx context.Context, teamName string) (model.TeamSettings, error)
+	SetTeamSettings(ctx context.Context, teamName string, settings model.TeamSettings) error
+	// GetTeamFallbacks returns the team's fallback teams in order of preference.
+	GetTeamFallbacks(ctx context.Context, teamName string) ([]string, error)
+	SetTeamFallbacks(ctx context.Context, teamName string, fallbacks []string) error
+	// GetTeamParent returns the parent team, "" for a top-level team.
+	GetTeamParent(ctx context.Context, teamName string) (string, error)
+	SetTeamParent(ctx context.Context, teamName, parent string) error
+	// GetSubteams returns the direct subteams of parent sorted by name, or
+	// the top-level teams if parent is "".
+	GetSubteams(ctx context.Context, parent string) ([]string, error)
+	// GetCodeOwners returns the team's ownership rules, empty if none were set.
+	GetCodeOwners(ctx context.Context, teamName string) (model.CodeOwners, error)
+	SetCodeOwners(ctx context.Context, teamName string, co model.CodeOwners) error
+	IsTeamArchived(ctx context.Context, teamName string) (bool, error)
+	SetTeamArchived(ctx context.Context, teamName string, archived bool) error
+	// DeleteTeam deletes the team, leaving its members without a team, and
+	// returns their ids.
+	DeleteTeam(ctx context.Context, teamName string) ([]string, error)
+
+	GetUser(ctx context.Context, userID string) (model.User, error)
+	SetUserActive(ctx context.Context, userID string, active bool) (model.User, error)
+	// SetUserTeam moves the user to teamName; "" removes them from their team.
+	SetUserTeam(ctx context.Context, userID, teamName string) (model.User, error)
+	SetUsername(ctx context.Context, userID, username string) (model.User, error)
+	SetUserTags(ctx context.Context, userID string, tags []string) (model.User, error)
+	// SetUserCapacity sets the user's limit of open reviews; nil removes it.
+	SetUserCapacity(ctx context.Context, userID string, maxOpenReviews *int) (model.User, error)
+	GetActiveUsersByTeam(ctx context.Context, teamName string) ([]model.User, error)
+	// LockUsers locks the user rows for the rest of the transaction and
+	// returns their current state.
+	LockUsers(ctx context.Context, userIDs []string) ([]model.User, error)
+
+	// SetAbsences replaces the user's absence schedule.
+	SetAbsences(ctx context.Context, userID string, absences []model.Absence) error
+	GetAbsences(ctx context.Context, userID string) ([]model.Absence, error)
+	// GetUsersWithStartedAbsences lists the users with an absence in progress
+	// whose reviews have not been reassigned yet.
+	GetUsersWithStartedAbsences(ctx context.Context) ([]string, error)
+	// ClaimStartedAbsences returns the absences of userID in progress whose
+	// reviews have not been reassigned yet, locking them for the rest of the
+	// transaction.
+	ClaimStartedAbsences(ctx context.Context, userID string) ([]model.Absence, error)
+	MarkAbsenceHandled(ctx context.Context, id int64) error
+
+	CreatePRWithReviewers(ctx context.Context, pr model.PullRequest) error
+	GetPR(ctx context.Context, prID string) (model.PullRequest, error)
+	// LockPR is GetPR that locks the pull request for the rest of the transaction.
+	LockPR(ctx context.Context, prID string) (model.PullRequest, error)
+	// MarkPRMerged sets the MERGED status; a non-empty forcedBy records who
+	// bypassed the approval policy.
+	MarkPRMerged(ctx context.Context, prID, forcedBy string) (model.PullRequest, error)
+	// SetPRStatus changes the status of a pull request that is not merged.
+	SetPRStatus(ctx context.Context, prID string, status model.PullRequestStatus) error
+	AddReviewers(ctx context.Context, prID string, reviews []model.Review) error
+	ReassignReviewer(ctx context.Context, prID, oldReviewerID string, replacement model.Review) error
+	RemoveReviewer(ctx context.Context, prID, reviewerID string) error
+	SetReviewState(ctx context.Context, prID, reviewerID string, state model.ReviewState) error
+	GetPRsForReviewer(ctx context.Context, userID string) ([]model.PullRequestShort, error)
+	// GetPRsByTeam returns the pull requests authored by current team members.
+	GetPRsByTeam(ctx context.Context, teamName string) ([]model.PullRequestShort, error)
+
+	// GetPRTimes returns the pull requests created or merged since the given
+	// time and all OPEN ones, of the team's members if teamName is set.
+	GetPRTimes(ctx context.Context, teamName string, since time.Time) ([]model.PRTimes, error)
+	// GetPairCounts counts, per reviewer, the assignments to authorID's pull
+	// requests made since the given time.
+	GetPairCounts(ctx context.Context, authorID string, reviewerIDs []string, since time.Time) (map[string]int, error)
+	// GetTeamPairings returns the author→reviewer counts for pull requests
+	// of the team's current members, assigned since the given time if set.
+	GetTeamPairings(ctx context.Context, teamName string, since *time.Time) ([]model.PairCount, error)
+	GetOpenReviewCounts(ctx context.Context, userIDs []string) (map[string]int, error)
+	// GetReviewerStats counts the assignments of every user matching the
+	// filter, including users with none.
+	GetReviewerStats(ctx context.Context, f model.ReviewerStatsFilter) ([]model.ReviewerStatsItem, error)
+}
+
+var (
+	_ Store = (*repository.Repository)(nil)
+	_ Store = (*repository.MemoryRepository)(nil)
+)
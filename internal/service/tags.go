@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+	"github.com/Mavichy/AvitoNovember/internal/repository"
+)
+
+// SetUserTags replaces the user's skill tags.
+func (s *Service) SetUserTags(ctx context.Context, userID string, tags []string) (model.User, error) {
+	u, err := s.repo.SetUserTags(ctx, userID, normalizeTags(tags))
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return model.User{}, NewDomainError(model.ErrorCodeNotFound, "user not found")
+		}
+		return model.User{}, err
+	}
+	return u, nil
+}
+
+// normalizeTags lowercases and trims the tags, dropping empty ones and
+// duplicates. A nil list stays nil so that it can mean "unchanged".
+func normalizeTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+	res := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t != "" && !contains(res, t) {
+			res = append(res, t)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func normalizeMemberTags(members []model.TeamMember) {
+	for i := range members {
+		members[i].Tags = normalizeTags(members[i].Tags)
+	}
+}
+
+// pickTagged picks pool members until every tag is covered by the users in
+// covered or by the picked reviews, or max reviewers are picked. Each time the
+// members covering the most uncovered tags are preferred, so that a member
+// with several tags is not crowded out by single-tag ones; pools only break
+// ties. Tags nobody available has are skipped. locked must hold the rows of
+// the pool members and of covered.
+func (s *Service) pickTagged(ctx context.Context, authorID string, pools []reviewerPool, locked map[string]model.User, tags, covered []string, max int) ([]model.Review, error) {
+	var res []model.Review
+	for len(res) < max {
+		have := append(append([]string(nil), covered...), reviewerIDs(res)...)
+		uncovered := uncoveredTags(locked, tags, have)
+		if len(uncovered) == 0 {
+			break
+		}
+
+		rv, ok, err := s.pickMostTagged(ctx, authorID, pools, locked, uncovered, res)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		res = append(res, rv)
+	}
+	return res, nil
+}
+
+// pickMostTagged picks one member not in picked, from those covering the
+// most of tags that are still available.
+func (s *Service) pickMostTagged(ctx context.Context, authorID string, pools []reviewerPool, locked map[string]model.User, tags []string, picked []model.Review) (model.Review, bool, error) {
+	score := func(userID string) int {
+		n := 0
+		for _, tag := range tags {
+			if contains(locked[userID].Tags, tag) {
+				n++
+			}
+		}
+		return n
+	}
+
+	for n := len(tags); n > 0; n-- {
+		for _, p := range pools {
+			var ids []string
+			for _, id := range stillActiveIn(locked, p.team, p.userIDs) {
+				if score(id) == n && !pickedIn(picked, id) {
+					ids = append(ids, id)
+				}
+			}
+			if len(ids) == 0 {
+				continue
+			}
+			sel, err := s.selectReviewers(ctx, p.team, authorID, locked, ids, 1)
+			if de, ok := AsDomainError(err); ok && de.Code == model.ErrorCodeNoCandidate {
+				continue
+			}
+			if err != nil {
+				return model.Review{}, false, err
+			}
+			if len(sel) > 0 {
+				return model.Review{ReviewerID: sel[0], SourceTeam: p.team}, true, nil
+			}
+		}
+	}
+	return model.Review{}, false, nil
+}
+
+// uncoveredTags returns the tags none of userIDs has.
+func uncoveredTags(locked map[string]model.User, tags, userIDs []string) []string {
+	var res []string
+	for _, tag := range tags {
+		done := false
+		for _, id := range userIDs {
+			done = done || contains(locked[id].Tags, tag)
+		}
+		if !done {
+			res = append(res, tag)
+		}
+	}
+	return res
+}
+
+func reviewerIDs(reviews []model.Review) []string {
+	ids := make([]string, 0, len(reviews))
+	for _, rv := range reviews {
+		ids = append(ids, rv.ReviewerID)
+	}
+	return ids
+}
+
+func pickedIn(reviews []model.Review, userID string) bool {
+	for _, rv := range reviews {
+		if rv.ReviewerID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutPicked drops the picked reviewers from the pools.
+func withoutPicked(pools []reviewerPool, picked []model.Review) []reviewerPool {
+	res := make([]reviewerPool, len(pools))
+	for i, p := range pools {
+		res[i] = reviewerPool{team: p.team}
+		for _, id := range p.userIDs {
+			if !pickedIn(picked, id) {
+				res[i].userIDs = append(res[i].userIDs, id)
+			}
+		}
+	}
+	return res
+}
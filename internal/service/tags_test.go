@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/Mavichy/AvitoNovember/internal/model"
+)
+
+func addTaggedTeam(t *testing.T, svc *Service, name string, reviewerCount int, tags map[string][]string) {
+	t.Helper()
+	team := model.Team{TeamName: name, TeamSettings: model.TeamSettings{ReviewerCount: reviewerCount}}
+	ids := make([]string, 0, len(tags))
+	for id := range tags {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		team.Members = append(team.Members, model.TeamMember{UserID: id, Username: id, IsActive: true, Tags: tags[id]})
+	}
+	if _, err := svc.AddTeam(context.Background(), team); err != nil {
+		t.Fatalf("AddTeam(%s): %v", name, err)
+	}
+}
+
+func TestTagCoverage(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+		tags  []string
+		want  []string
+	}{
+		// One reviewer can only cover both tags if it is the member having both.
+		{"one reviewer for two tags", 1, []string{"go", "sql"}, []string{"gs"}},
+		{"remaining tag after the best match", 2, []string{"go", "js", "sql"}, []string{"gs", "j"}},
+		{"tags are normalized", 1, []string{" SQL ", "Go"}, []string{"gs"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			svc, _ := newTestService(t)
+			addTaggedTeam(t, svc, "backend", tt.count, map[string][]string{
+				"a":  {"go", "sql"},
+				"g":  {"go"},
+				"g2": {"go"},
+				"s":  {"sql"},
+				"gs": {"go", "sql"},
+				"j":  {"js"},
+			})
+
+			// Several PRs, so that round-robin gets a chance to go wrong.
+			for _, id := range []string{"p1", "p2", "p3"} {
+				pr, err := svc.CreatePR(ctx, CreatePRInput{ID: id, Name: id, AuthorID: "a", RequiredTags: tt.tags})
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := append([]string(nil), pr.AssignedReviewers...)
+				sort.Strings(got)
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Fatalf("%s reviewers = %v, want %v", id, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// Tags nobody has are skipped and the rest of the reviewers are picked as
+// usual.
+func TestTagCoverageUnknownTag(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	addTaggedTeam(t, svc, "backend", 2, map[string][]string{
+		"a": nil,
+		"b": {"go"},
+		"c": nil,
+		"d": nil,
+	})
+
+	pr, err := svc.CreatePR(ctx, CreatePRInput{ID: "p", Name: "p", AuthorID: "a", RequiredTags: []string{"rust", "go"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pr.AssignedReviewers) != 2 || !contains(pr.AssignedReviewers, "b") {
+		t.Fatalf("reviewers = %v, want b and one more", pr.AssignedReviewers)
+	}
+}